@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/ignoxx/caloriemate/nutrition"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// used until onboarding created a profile with the user's weight
+const defaultWeightKg = 70
+
+// applyActivityCalories computes calories_burned from the activity and the
+// user's current profile, whatever the client sent.
+func applyActivityCalories(app core.App, record *core.Record) error {
+	activity := nutrition.Activity{
+		Type:            record.GetString("activity_type"),
+		MET:             record.GetFloat("met"),
+		Steps:           record.GetInt("steps"),
+		DurationMinutes: record.GetFloat("duration_minutes"),
+		AvgHeartRate:    record.GetFloat("avg_heart_rate"),
+	}
+
+	met, err := nutrition.ActivityMET(activity)
+	if err != nil {
+		return apis.NewBadRequestError("Invalid activity: "+err.Error(), err)
+	}
+
+	var profile nutrition.Profile
+	if profileRecord, err := app.FindFirstRecordByData(types.COL_USER_PROFILES, "user", record.GetString("user")); err == nil {
+		profile = nutrition.ProfileFromRecord(profileRecord)
+	}
+	if profile.WeightKg <= 0 {
+		profile.WeightKg = defaultWeightKg
+	}
+
+	calories, err := nutrition.ActivityCalories(activity, profile)
+	if errors.Is(err, nutrition.ErrNoActivityAmount) {
+		return apis.NewBadRequestError("Steps or duration is required", err)
+	}
+	if err != nil {
+		return apis.NewBadRequestError("Invalid activity: "+err.Error(), err)
+	}
+
+	record.Set("met", met)
+	record.Set("calories_burned", calories)
+
+	slog.Info("Computed activity calories", "recordId", record.Id, "type", activity.Type, "calories", calories, "weightKg", profile.WeightKg)
+	return nil
+}
+
+// activityInputsChanged tells whether an update touched a field the burned
+// calories are computed from.
+func activityInputsChanged(record *core.Record) bool {
+	original := record.Original()
+	if original.GetString("activity_type") != record.GetString("activity_type") {
+		return true
+	}
+
+	for _, field := range []string{"met", "steps", "duration_minutes", "avg_heart_rate"} {
+		if original.GetFloat(field) != record.GetFloat(field) {
+			return true
+		}
+	}
+
+	return false
+}
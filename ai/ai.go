@@ -1,13 +1,28 @@
 package ai
 
 import (
+	"errors"
 	"io"
 
 	"github.com/ignoxx/caloriemate/types"
 )
 
+// ErrTextNotSupported is returned by embedders that only understand images.
+var ErrTextNotSupported = errors.New("embedder does not support text")
+
+// EmbeddingModel identifies the model behind a set of vectors, vectors of
+// different models can't be compared.
+type EmbeddingModel struct {
+	Name       string
+	Dimensions int
+}
+
 type Embedder interface {
+	Model() (EmbeddingModel, error)
 	GenerateEmbeddings(input io.ReadSeeker) ([]float32, error)
+	// GenerateTextEmbeddings embeds text into the same space as images, so a
+	// query like "ramen" can be matched against meal photos.
+	GenerateTextEmbeddings(text string) ([]float32, error)
 }
 
 type Analyzer interface {
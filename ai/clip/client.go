@@ -3,11 +3,13 @@ package clip
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"sync"
 
 	"github.com/ignoxx/caloriemate/ai"
 )
@@ -15,6 +17,9 @@ import (
 type CLIPClient struct {
 	baseURL string
 	client  *http.Client
+
+	mu    sync.Mutex
+	model *ai.EmbeddingModel
 }
 
 type EmbeddingResponse struct {
@@ -23,16 +28,59 @@ type EmbeddingResponse struct {
 	Dimensions int       `json:"dimensions"`
 }
 
-func New() *CLIPClient {
-	host, ok := os.LookupEnv("CLIP_HOST")
-	if !ok {
-		panic("CLIP_HOST environment variable not set")
+type ModelInfoResponse struct {
+	Model               string `json:"model"`
+	EmbeddingDimensions int    `json:"embedding_dimensions"`
+}
+
+var ErrNoHost = errors.New("CLIP_HOST environment variable not set")
+
+// New returns a client for the CLIP service at CLIP_HOST, or ErrNoHost when
+// it isn't configured so the caller can fall back to another embedder.
+func New() (*CLIPClient, error) {
+	host := os.Getenv("CLIP_HOST")
+	if host == "" {
+		return nil, ErrNoHost
 	}
 
 	return &CLIPClient{
 		baseURL: host,
 		client:  &http.Client{},
+	}, nil
+}
+
+// Model asks the service which model it runs. The answer is cached, the
+// model can only change with a restart of both.
+func (c *CLIPClient) Model() (ai.EmbeddingModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.model != nil {
+		return *c.model, nil
+	}
+
+	resp, err := c.client.Get(c.baseURL + "/model/info")
+	if err != nil {
+		return ai.EmbeddingModel{}, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return ai.EmbeddingModel{}, fmt.Errorf("CLIP service error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var info ModelInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return ai.EmbeddingModel{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	c.model = &ai.EmbeddingModel{
+		Name:       "clip/" + info.Model,
+		Dimensions: info.EmbeddingDimensions,
 	}
+
+	return *c.model, nil
 }
 
 func (c *CLIPClient) GenerateEmbeddings(image io.ReadSeeker) ([]float32, error) {
@@ -72,6 +120,26 @@ func (c *CLIPClient) generateEmbeddingsWithError(image io.ReadSeeker) ([]float32
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
+	return c.doEmbeddingRequest(req)
+}
+
+func (c *CLIPClient) GenerateTextEmbeddings(text string) ([]float32, error) {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/embed/text", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.doEmbeddingRequest(req)
+}
+
+func (c *CLIPClient) doEmbeddingRequest(req *http.Request) ([]float32, error) {
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
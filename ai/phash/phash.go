@@ -0,0 +1,220 @@
+// Package phash is a built-in image embedder that needs no external
+// service. A vector is a 64 bit DCT perceptual hash followed by a 64 bin
+// color histogram, both halves scaled so the whole vector has unit length.
+// Identical and near identical photos land very close, which is enough for
+// duplicate detection, while the colors give a rough notion of similar
+// meals. It is much weaker than CLIP and can't embed text.
+package phash
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"slices"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/ignoxx/caloriemate/ai"
+)
+
+const (
+	MODEL = "builtin/phash-colorhist-v1"
+
+	hashSize   = 8
+	dctSize    = 32
+	sampleSize = 64
+	colorBins  = 4
+
+	dimensions = hashSize*hashSize + colorBins*colorBins*colorBins
+)
+
+type Embedder struct{}
+
+func New() *Embedder {
+	return &Embedder{}
+}
+
+func (p *Embedder) Model() (ai.EmbeddingModel, error) {
+	return ai.EmbeddingModel{Name: MODEL, Dimensions: dimensions}, nil
+}
+
+func (p *Embedder) GenerateEmbeddings(input io.ReadSeeker) ([]float32, error) {
+	img, _, err := image.Decode(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+
+	half := float32(1 / math.Sqrt2)
+
+	vector := make([]float32, 0, dimensions)
+	for _, v := range perceptualHash(img) {
+		vector = append(vector, v*half)
+	}
+	for _, v := range colorHistogram(img) {
+		vector = append(vector, v*half)
+	}
+
+	return vector, nil
+}
+
+func (p *Embedder) GenerateTextEmbeddings(text string) ([]float32, error) {
+	return nil, ai.ErrTextNotSupported
+}
+
+// perceptualHash returns the pHash bits as a unit vector of ±1/8, so the
+// squared distance of two hashes is their hamming distance divided by 16.
+func perceptualHash(img image.Image) []float32 {
+	gray := downsample(img, dctSize)
+
+	pixels := make([][]float64, dctSize)
+	for y := range pixels {
+		pixels[y] = make([]float64, dctSize)
+		for x := range pixels[y] {
+			r, g, b := gray[y*dctSize+x][0], gray[y*dctSize+x][1], gray[y*dctSize+x][2]
+			pixels[y][x] = 0.299*r + 0.587*g + 0.114*b
+		}
+	}
+
+	coefficients := dct2D(pixels)
+
+	low := make([]float64, 0, hashSize*hashSize)
+	for y := range hashSize {
+		low = append(low, coefficients[y][:hashSize]...)
+	}
+
+	// the DC term only says how bright the photo is, it stays out of the median
+	sorted := slices.Clone(low[1:])
+	slices.Sort(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	bit := float32(1.0 / hashSize)
+	hash := make([]float32, len(low))
+	for i, c := range low {
+		if c > median {
+			hash[i] = bit
+		} else {
+			hash[i] = -bit
+		}
+	}
+
+	return hash
+}
+
+// colorHistogram counts the colors of a downsampled copy in 4x4x4 RGB bins.
+// It returns the square roots of the bin shares, which have unit length and
+// keep one dominant color from drowning out the rest.
+func colorHistogram(img image.Image) []float32 {
+	samples := downsample(img, sampleSize)
+
+	counts := make([]float64, colorBins*colorBins*colorBins)
+	for _, c := range samples {
+		r := min(int(c[0]*colorBins/256), colorBins-1)
+		g := min(int(c[1]*colorBins/256), colorBins-1)
+		b := min(int(c[2]*colorBins/256), colorBins-1)
+		counts[(r*colorBins+g)*colorBins+b]++
+	}
+
+	histogram := make([]float32, len(counts))
+	for i, n := range counts {
+		histogram[i] = float32(math.Sqrt(n / float64(len(samples))))
+	}
+
+	return histogram
+}
+
+// downsample averages the image into size x size cells of 8 bit RGB.
+func downsample(img image.Image, size int) [][3]float64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	cells := make([][3]float64, size*size)
+	counts := make([]float64, size*size)
+
+	// large photos are sampled on a grid, every pixel would be wasted work
+	step := max(1, min(w, h)/(size*4))
+
+	for y := 0; y < h; y += step {
+		cy := y * size / h
+		for x := 0; x < w; x += step {
+			cx := x * size / w
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+
+			i := cy*size + cx
+			cells[i][0] += float64(r >> 8)
+			cells[i][1] += float64(g >> 8)
+			cells[i][2] += float64(b >> 8)
+			counts[i]++
+		}
+	}
+
+	for i := range cells {
+		if counts[i] == 0 {
+			continue
+		}
+		cells[i][0] /= counts[i]
+		cells[i][1] /= counts[i]
+		cells[i][2] /= counts[i]
+	}
+
+	return cells
+}
+
+// dct2D is a plain DCT-II over rows, then columns. At 32x32 there is no
+// need for anything faster.
+func dct2D(pixels [][]float64) [][]float64 {
+	n := len(pixels)
+
+	cosines := make([][]float64, n)
+	for k := range cosines {
+		cosines[k] = make([]float64, n)
+		for i := range cosines[k] {
+			cosines[k][i] = math.Cos(math.Pi / float64(n) * (float64(i) + 0.5) * float64(k))
+		}
+	}
+
+	transform := func(values []float64) []float64 {
+		out := make([]float64, n)
+		for k := range out {
+			var sum float64
+			for i, v := range values {
+				sum += v * cosines[k][i]
+			}
+			out[k] = sum
+		}
+		return out
+	}
+
+	rows := make([][]float64, n)
+	for y := range pixels {
+		rows[y] = transform(pixels[y])
+	}
+
+	out := make([][]float64, n)
+	for y := range out {
+		out[y] = make([]float64, n)
+	}
+
+	column := make([]float64, n)
+	for x := range n {
+		for y := range n {
+			column[y] = rows[y][x]
+		}
+		for y, v := range transform(column) {
+			out[y][x] = v
+		}
+	}
+
+	return out
+}
+
+// Ensure Embedder implements the Embedder interface
+var _ ai.Embedder = (*Embedder)(nil)
@@ -0,0 +1,394 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const (
+	accountVectors = "meal_image_vectors"
+	accountSearch  = "meal_templates_fts"
+	accountFiles   = "files"
+	accountLogs    = "logs"
+)
+
+// userCollections returns every collection with a user relation, the ones
+// pointing at other owned collections first so they are deleted before
+// what they reference.
+func userCollections(app core.App) ([]*core.Collection, error) {
+	users, err := app.FindCollectionByNameOrId(types.COL_USERS)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := app.FindAllCollections(core.CollectionTypeBase)
+	if err != nil {
+		return nil, err
+	}
+
+	var owned []*core.Collection
+	for _, c := range all {
+		if field, ok := c.Fields.GetByName("user").(*core.RelationField); ok && field.CollectionId == users.Id {
+			owned = append(owned, c)
+		}
+	}
+
+	references := func(c *core.Collection) int {
+		n := 0
+		for _, field := range c.Fields {
+			relation, ok := field.(*core.RelationField)
+			if !ok || relation.CollectionId == users.Id || relation.CollectionId == c.Id {
+				continue
+			}
+			if slices.ContainsFunc(owned, func(o *core.Collection) bool { return o.Id == relation.CollectionId }) {
+				n++
+			}
+		}
+		return n
+	}
+
+	slices.SortStableFunc(owned, func(a, b *core.Collection) int {
+		return references(b) - references(a)
+	})
+
+	return owned, nil
+}
+
+// WriteAccountExport writes a zip with all of the user's records, one JSON
+// file per collection, and the original uploaded files under files/.
+func WriteAccountExport(app core.App, user *core.Record, w io.Writer) error {
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	collections, err := userCollections(app)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+
+	user.IgnoreEmailVisibility(true)
+	if err := writeAccountRecords(archive, fsys, types.COL_USERS, []*core.Record{user}); err != nil {
+		return err
+	}
+
+	for _, collection := range collections {
+		records, err := app.FindAllRecords(collection, dbx.HashExp{"user": user.Id})
+		if err != nil {
+			return err
+		}
+
+		if err := writeAccountRecords(archive, fsys, collection.Name, records); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeAccountRecords(archive *zip.Writer, fsys *filesystem.System, name string, records []*core.Record) error {
+	f, err := archive.Create(name + ".json")
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(records); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		for _, field := range record.Collection().Fields {
+			if field.Type() != core.FieldTypeFile {
+				continue
+			}
+
+			for _, fileName := range record.GetStringSlice(field.GetName()) {
+				if err := copyRecordFile(archive, fsys, record, name, fileName); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func copyRecordFile(archive *zip.Writer, fsys *filesystem.System, record *core.Record, collectionName, fileName string) error {
+	reader, err := fsys.GetReader(record.BaseFilesPath() + "/" + fileName)
+	if err != nil {
+		// a missing file should not make the rest of the export unavailable
+		slog.Warn("Skipping missing file in account export", "recordId", record.Id, "file", fileName, "error", err)
+		return nil
+	}
+	defer reader.Close()
+
+	f, err := archive.Create(fmt.Sprintf("files/%s/%s/%s", collectionName, record.Id, fileName))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, reader)
+	return err
+}
+
+// DeleteAccount deletes the user and everything they own: records of every
+// collection with a user relation, uploaded files, image embeddings, the
+// search index and the log entries made for the user. Afterwards it looks for anything left and
+// reports it. The request log of the deletion itself is kept until the log
+// retention removes it.
+func DeleteAccount(app core.App, user *core.Record) (types.AccountDeletionReport, error) {
+	report := types.AccountDeletionReport{
+		UserID:    user.Id,
+		Deleted:   map[string]int{},
+		Remaining: map[string]int{},
+	}
+
+	collections, err := userCollections(app)
+	if err != nil {
+		return report, err
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return report, err
+	}
+	defer fsys.Close()
+
+	var filePaths []string
+
+	// counted up front, the files of deleted records go away on commit
+	addFiles := func(path string) {
+		files, _ := fsys.List(path + "/")
+		report.Deleted[accountFiles] += len(files)
+		filePaths = append(filePaths, path)
+	}
+	addFiles(user.BaseFilesPath())
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, collection := range collections {
+			records, err := txApp.FindAllRecords(collection, dbx.HashExp{"user": user.Id})
+			if err != nil {
+				return err
+			}
+
+			for _, record := range records {
+				addFiles(record.BaseFilesPath())
+
+				// relations with cascade delete may have taken it already
+				if _, err := txApp.FindRecordById(collection, record.Id); err != nil {
+					continue
+				}
+				if err := txApp.Delete(record); err != nil {
+					return err
+				}
+			}
+
+			report.Deleted[collection.Name] = len(records)
+		}
+
+		deleted, err := deleteAccountVectors(txApp, user.Id)
+		if err != nil {
+			return err
+		}
+		report.Deleted[accountVectors] = deleted
+
+		// the delete hooks clear these too, but only after the commit
+		result, err := txApp.DB().NewQuery("DELETE FROM meal_templates_fts WHERE user_id = {:id}").Bind(dbx.Params{
+			"id": user.Id,
+		}).Execute()
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			report.Deleted[accountSearch] = int(n)
+		}
+
+		if err := txApp.Delete(user); err != nil {
+			return err
+		}
+		report.Deleted[types.COL_USERS] = 1
+
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// files are normally removed after the commit, doing it here makes sure
+	// they are gone before verifying
+	for _, path := range filePaths {
+		for _, err := range fsys.DeletePrefix(path + "/") {
+			slog.Error("Failed to delete account files", "path", path, "error", err)
+		}
+	}
+
+	result, err := app.AuxDB().NewQuery("DELETE FROM {{_logs}} WHERE json_extract([[data]], '$.authId') = {:id}").Bind(dbx.Params{
+		"id": user.Id,
+	}).Execute()
+	if err != nil {
+		slog.Error("Failed to delete account logs", "error", err)
+	} else if n, err := result.RowsAffected(); err == nil {
+		report.Deleted[accountLogs] = int(n)
+	}
+
+	if err := verifyAccountDeleted(app, fsys, user.Id, collections, filePaths, &report); err != nil {
+		return report, err
+	}
+
+	slog.Info("Deleted account", "verified", report.Verified)
+
+	return report, nil
+}
+
+// deleteAccountVectors removes the user's embeddings from every vector set,
+// which are partitioned by user.
+func deleteAccountVectors(app core.App, userID string) (int, error) {
+	sets, err := FindVectorSets(app)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, set := range sets {
+		result, err := app.DB().NewQuery("DELETE FROM {{" + set.Name + "}} WHERE user_id = {:id}").Bind(dbx.Params{
+			"id": userID,
+		}).Execute()
+		if err != nil {
+			return deleted, err
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			deleted += int(n)
+		}
+	}
+
+	return deleted, nil
+}
+
+func verifyAccountDeleted(app core.App, fsys *filesystem.System, userID string, collections []*core.Collection, filePaths []string, report *types.AccountDeletionReport) error {
+	if _, err := app.FindRecordById(types.COL_USERS, userID); err == nil {
+		report.Remaining[types.COL_USERS] = 1
+	}
+
+	for _, collection := range collections {
+		n, err := app.CountRecords(collection, dbx.HashExp{"user": userID})
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			report.Remaining[collection.Name] = int(n)
+		}
+	}
+
+	sets, err := FindVectorSets(app)
+	if err != nil {
+		return err
+	}
+	for _, set := range sets {
+		var vectors int
+		if err := app.DB().NewQuery("SELECT COUNT(*) FROM {{" + set.Name + "}} WHERE user_id = {:id}").Bind(dbx.Params{
+			"id": userID,
+		}).Row(&vectors); err != nil {
+			return err
+		}
+		if vectors > 0 {
+			report.Remaining[accountVectors] += vectors
+		}
+	}
+
+	var indexed int
+	if err := app.DB().NewQuery("SELECT COUNT(*) FROM meal_templates_fts WHERE user_id = {:id}").Bind(dbx.Params{
+		"id": userID,
+	}).Row(&indexed); err != nil {
+		return err
+	}
+	if indexed > 0 {
+		report.Remaining[accountSearch] = indexed
+	}
+
+	for _, path := range filePaths {
+		files, err := fsys.List(path + "/")
+		if err != nil {
+			return err
+		}
+		report.Remaining[accountFiles] += len(files)
+	}
+	if report.Remaining[accountFiles] == 0 {
+		delete(report.Remaining, accountFiles)
+	}
+
+	var logs int
+	if err := app.AuxDB().NewQuery("SELECT COUNT(*) FROM {{_logs}} WHERE json_extract([[data]], '$.authId') = {:id}").Bind(dbx.Params{
+		"id": userID,
+	}).Row(&logs); err != nil {
+		return err
+	}
+	if logs > 0 {
+		report.Remaining[accountLogs] = logs
+	}
+
+	report.Verified = len(report.Remaining) == 0
+	return nil
+}
+
+// accountUser makes sure the request is made by a regular user, superusers
+// have no diary to export or delete.
+func accountUser(e *core.RequestEvent) (*core.Record, error) {
+	if e.Auth == nil || e.Auth.Collection().Name != types.COL_USERS {
+		return nil, apis.NewForbiddenError("Only user accounts can be exported or deleted", nil)
+	}
+
+	return e.Auth, nil
+}
+
+func HandleGetAccountExport(e *core.RequestEvent) error {
+	user, err := accountUser(e)
+	if err != nil {
+		return err
+	}
+
+	e.Response.Header().Set("Content-Type", "application/zip")
+	e.Response.Header().Set("Content-Disposition", `attachment; filename="caloriemate-account-`+user.Id+`.zip"`)
+
+	if err := WriteAccountExport(e.App, user, e.Response); err != nil {
+		slog.Error("Failed to write account export", "userId", user.Id, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// HandleDeleteAccount deletes the caller's account and everything in it.
+// The report is returned even when verification found leftovers, so they
+// can be followed up on.
+func HandleDeleteAccount(e *core.RequestEvent) error {
+	user, err := accountUser(e)
+	if err != nil {
+		return err
+	}
+
+	report, err := DeleteAccount(e.App, user)
+	if err != nil {
+		return apis.NewInternalServerError("Failed to delete account", err)
+	}
+
+	if !report.Verified {
+		slog.Error("Account deletion left data behind", "remaining", report.Remaining)
+	}
+
+	return e.JSON(200, report)
+}
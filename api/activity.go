@@ -0,0 +1,143 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/ignoxx/caloriemate/importer"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/workout"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// HandlePostActivityImport turns an uploaded GPX, TCX or FIT file into an
+// activity log. The activity_type form value overrides the detected sport.
+// Calories are computed by the activity_logs record hook.
+func HandlePostActivityImport(e *core.RequestEvent) error {
+	files, err := e.FindUploadedFiles("file")
+	if err != nil || len(files) == 0 {
+		return apis.NewBadRequestError("A workout file is required", err)
+	}
+	upload := files[0]
+
+	reader, err := upload.Reader.Open()
+	if err != nil {
+		return apis.NewBadRequestError("Could not read workout file", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return apis.NewBadRequestError("Could not read workout file", err)
+	}
+
+	w, err := workout.Parse(upload.OriginalName, data)
+	if err != nil {
+		return apis.NewBadRequestError("Could not parse workout file: "+err.Error(), err)
+	}
+
+	activityType := w.Sport
+	if override := e.Request.FormValue("activity_type"); override != "" {
+		activityType = override
+	}
+	if activityType == "" {
+		return apis.NewBadRequestError("Could not detect the sport, pass an activity_type", nil)
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId(types.COL_ACTIVITY_LOGS)
+	if err != nil {
+		return apis.NewInternalServerError("Could not find activity logs", err)
+	}
+
+	file, err := filesystem.NewFileFromBytes(data, upload.OriginalName)
+	if err != nil {
+		return apis.NewBadRequestError("Could not store workout file", err)
+	}
+
+	record := importer.NewWorkoutActivity(collection, e.Auth.Id, activityType, w)
+	record.Set("source_file", file)
+
+	if err := e.App.Save(record); err != nil {
+		return apis.NewBadRequestError("Failed to save activity", err)
+	}
+
+	slog.Info("Imported workout", "recordId", record.Id, "type", activityType, "file", upload.OriginalName)
+
+	return e.JSON(200, record)
+}
+
+// HandlePostHealthImport imports an Apple Health or Google Takeout export
+// zip. Importing the same export again only adds what is new.
+func HandlePostHealthImport(e *core.RequestEvent) error {
+	files, err := e.FindUploadedFiles("file")
+	if err != nil || len(files) == 0 {
+		return apis.NewBadRequestError("An export zip is required", err)
+	}
+
+	// zip needs random access, exports are too large to keep in memory
+	path, err := saveTempUpload(files[0])
+	if err != nil {
+		return apis.NewBadRequestError("Could not read export", err)
+	}
+	defer os.Remove(path)
+
+	report, err := importer.ImportHealthArchive(e.App, e.Auth.Id, path)
+	if err != nil {
+		return apis.NewBadRequestError("Could not import export: "+err.Error(), err)
+	}
+
+	slog.Info("Imported health export", "userId", e.Auth.Id, "source", report.Source,
+		"steps", report.Steps.Created, "weights", report.Weights.Created, "workouts", report.Workouts.Created)
+
+	return e.JSON(200, report)
+}
+
+// HandlePostDiaryImport imports a MyFitnessPal or Cronometer CSV export.
+// With dry_run=true it only reports what would be imported.
+func HandlePostDiaryImport(e *core.RequestEvent) error {
+	files, err := e.FindUploadedFiles("file")
+	if err != nil || len(files) == 0 {
+		return apis.NewBadRequestError("A diary CSV is required", err)
+	}
+
+	reader, err := files[0].Reader.Open()
+	if err != nil {
+		return apis.NewBadRequestError("Could not read diary", err)
+	}
+	defer reader.Close()
+
+	dryRun := e.Request.URL.Query().Get("dry_run") == "true"
+
+	report, err := importer.ImportDiary(e.App, e.Auth.Id, reader, dryRun)
+	if err != nil {
+		return apis.NewBadRequestError("Could not import diary: "+err.Error(), err)
+	}
+
+	slog.Info("Imported diary", "userId", e.Auth.Id, "source", report.Source, "dryRun", dryRun,
+		"meals", report.Meals.Created, "entries", report.Entries.Created)
+
+	return e.JSON(200, report)
+}
+
+func saveTempUpload(upload *filesystem.File) (string, error) {
+	reader, err := upload.Reader.Open()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp("", "caloriemate-import-*")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/ignoxx/caloriemate/nutrition"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	adaptiveWindowDays = 28
+
+	// below these the intake average or the trend slope is mostly noise
+	minAdaptiveLoggedDays   = 14
+	minAdaptiveWeightPoints = 3
+
+	// smaller changes than this are not worth bothering the user with
+	minProposalChange = 50
+)
+
+// buildAdaptiveEstimate back-computes the user's maintenance calories from
+// the last full adaptiveWindowDays days. Days without logged meals are left
+// out of the intake average instead of counting as zero.
+func buildAdaptiveEstimate(app core.App, profile *core.Record, now time.Time) (types.AdaptiveEstimate, error) {
+	userID := profile.GetString("user")
+	loc := utils.UserLocation(app, userID)
+	windowEnd, _ := utils.DayBounds(now.In(loc), loc)
+	windowStart := windowEnd.AddDate(0, 0, -adaptiveWindowDays)
+
+	nutritionProfile := nutrition.ProfileFromRecord(profile)
+
+	estimate := types.AdaptiveEstimate{
+		WindowStart:     windowStart.Format(utils.DateLayout),
+		WindowEnd:       windowEnd.AddDate(0, 0, -1).Format(utils.DateLayout),
+		WindowDays:      adaptiveWindowDays,
+		CurrentCalories: profile.GetFloat("target_calories"),
+	}
+	if nutritionProfile.Complete() {
+		estimate.FormulaTDEE = math.Round(nutrition.TDEE(nutritionProfile))
+	}
+
+	totals, err := loadDayTotals(app, userID, windowStart, windowEnd, loc)
+	if err != nil {
+		return estimate, err
+	}
+
+	var intake float64
+	for _, day := range totals {
+		if day.logged {
+			estimate.LoggedDays++
+			intake += day.intake.Calories
+		}
+	}
+
+	_, samples, err := loadWeightSamples(app, userID, windowStart.Add(-trendWarmup))
+	if err != nil {
+		return estimate, err
+	}
+	trend := nutrition.SmoothWeights(samples)
+
+	// the trend is read at the last weigh-in before the window, or at the
+	// first one inside it when tracking started during the window
+	startIdx, endIdx := -1, -1
+	for i, sample := range samples {
+		if sample.At.Before(windowStart) {
+			startIdx = i
+			continue
+		}
+		if sample.At.Before(windowEnd) {
+			estimate.WeightPoints++
+			if startIdx == -1 {
+				startIdx = i
+			}
+			endIdx = i
+		}
+	}
+
+	switch {
+	case estimate.LoggedDays < minAdaptiveLoggedDays:
+		estimate.Reason = "not enough days with logged meals"
+		return estimate, nil
+	case estimate.WeightPoints < minAdaptiveWeightPoints || startIdx == -1 || endIdx <= startIdx:
+		estimate.Reason = "not enough weigh-ins"
+		return estimate, nil
+	}
+
+	estimate.AverageIntake = math.Round(intake / float64(estimate.LoggedDays))
+	estimate.TrendStartKg = math.Round(trend[startIdx]*100) / 100
+	estimate.TrendEndKg = math.Round(trend[endIdx]*100) / 100
+
+	days := samples[endIdx].At.Sub(samples[startIdx].At).Hours() / 24
+	tdee := nutrition.AdaptiveTDEE(estimate.AverageIntake, trend[startIdx], trend[endIdx], days)
+
+	estimate.EstimatedTDEE = math.Round(tdee)
+	adjustment := nutrition.GoalAdjustmentFor(app, userID, nutritionProfile.Goal)
+	estimate.ProposedCalories = nutrition.RoundCalories(tdee + adjustment)
+	estimate.Sufficient = true
+
+	return estimate, nil
+}
+
+// ProposeAdaptiveTargets creates a pending calorie target proposal for every
+// user with enough data, superseding older pending proposals. Nothing is
+// applied until the user accepts it.
+func ProposeAdaptiveTargets(app core.App) {
+	profiles, err := app.FindAllRecords(types.COL_USER_PROFILES)
+	if err != nil {
+		slog.Error("Failed to load profiles for adaptive targets", "error", err)
+		return
+	}
+
+	collection, err := app.FindCollectionByNameOrId(types.COL_TDEE_PROPOSALS)
+	if err != nil {
+		slog.Error("Failed to find tdee_proposals collection", "error", err)
+		return
+	}
+
+	for _, profile := range profiles {
+		estimate, err := buildAdaptiveEstimate(app, profile, time.Now())
+		if err != nil {
+			slog.Error("Failed to estimate adaptive TDEE", "error", err, "profileId", profile.Id)
+			continue
+		}
+
+		if !estimate.Sufficient || math.Abs(estimate.ProposedCalories-estimate.CurrentCalories) < minProposalChange {
+			continue
+		}
+
+		userID := profile.GetString("user")
+
+		_, err = app.DB().Update(types.COL_TDEE_PROPOSALS,
+			dbx.Params{"status": "superseded"},
+			dbx.HashExp{"user": userID, "status": "pending"},
+		).Execute()
+		if err != nil {
+			slog.Error("Failed to supersede pending proposals", "error", err, "userId", userID)
+			continue
+		}
+
+		proposal := core.NewRecord(collection)
+		proposal.Set("user", userID)
+		proposal.Set("estimated_tdee", estimate.EstimatedTDEE)
+		proposal.Set("formula_tdee", estimate.FormulaTDEE)
+		proposal.Set("current_calories", estimate.CurrentCalories)
+		proposal.Set("proposed_calories", estimate.ProposedCalories)
+		proposal.Set("logged_days", estimate.LoggedDays)
+		proposal.Set("window_start", estimate.WindowStart)
+		proposal.Set("window_end", estimate.WindowEnd)
+		proposal.Set("status", "pending")
+
+		if err := app.Save(proposal); err != nil {
+			slog.Error("Failed to save TDEE proposal", "error", err, "userId", userID)
+			continue
+		}
+
+		slog.Info("Proposed adaptive calorie target", "userId", userID, "current", estimate.CurrentCalories, "proposed", estimate.ProposedCalories)
+	}
+}
+
+func HandleGetAdaptiveTDEE(e *core.RequestEvent) error {
+	profile, err := e.App.FindFirstRecordByData(types.COL_USER_PROFILES, "user", e.Auth.Id)
+	if err != nil {
+		return apis.NewNotFoundError("User profile not found", err)
+	}
+
+	estimate, err := buildAdaptiveEstimate(e.App, profile, time.Now())
+	if err != nil {
+		return apis.NewBadRequestError("Could not estimate TDEE", err)
+	}
+
+	return e.JSON(200, estimate)
+}
+
+func findPendingProposal(e *core.RequestEvent) (*core.Record, error) {
+	proposal, err := e.App.FindRecordById(types.COL_TDEE_PROPOSALS, e.Request.PathValue("id"))
+	if err != nil {
+		return nil, apis.NewNotFoundError("Proposal not found", err)
+	}
+
+	if proposal.GetString("user") != e.Auth.Id {
+		return nil, apis.NewForbiddenError("Access denied", nil)
+	}
+
+	if proposal.GetString("status") != "pending" {
+		return nil, apis.NewBadRequestError("Proposal is no longer pending", nil)
+	}
+
+	return proposal, nil
+}
+
+func HandlePostTDEEProposalAccept(e *core.RequestEvent) error {
+	proposal, err := findPendingProposal(e)
+	if err != nil {
+		return err
+	}
+
+	profile, err := e.App.FindFirstRecordByData(types.COL_USER_PROFILES, "user", e.Auth.Id)
+	if err != nil {
+		return apis.NewNotFoundError("User profile not found", err)
+	}
+
+	targets := nutrition.MacrosForCalories(proposal.GetFloat("proposed_calories"), profile.GetFloat("weight_kg"))
+
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		// accepted targets are no longer formula based, keep them as custom
+		profile.Set("custom_targets", true)
+		profile.Set("target_calories", targets.Calories)
+		profile.Set("target_protein_g", targets.ProteinG)
+		profile.Set("target_carbs_g", targets.CarbsG)
+		profile.Set("target_fat_g", targets.FatG)
+		if err := txApp.Save(profile); err != nil {
+			return err
+		}
+
+		proposal.Set("status", "accepted")
+		return txApp.Save(proposal)
+	})
+	if err != nil {
+		return apis.NewBadRequestError("Failed to apply proposal", err)
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": true,
+		"message": "Calorie target updated",
+		"targets": targets,
+	})
+}
+
+func HandlePostTDEEProposalReject(e *core.RequestEvent) error {
+	proposal, err := findPendingProposal(e)
+	if err != nil {
+		return err
+	}
+
+	proposal.Set("status", "rejected")
+	if err := e.App.Save(proposal); err != nil {
+		return apis.NewBadRequestError("Failed to reject proposal", err)
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": true,
+		"message": "Proposal rejected",
+	})
+}
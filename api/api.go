@@ -2,16 +2,25 @@ package api
 
 import (
 	"log/slog"
+	"net/url"
+	"strconv"
 
-	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
-	"github.com/ignoxx/caloriemate/ai"
-	"github.com/ignoxx/caloriemate/ai/clip"
 	"github.com/ignoxx/caloriemate/types"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 )
 
+const (
+	defaultSimilarLimit = 3
+	maxSimilarLimit     = 50
+	// vec0 refuses larger k values
+	maxSimilarK = 4096
+)
+
+// HandleGetSimilarMealTemplates lists the caller's meals that look most like
+// the given one, using its stored image vector. Supports limit, page and
+// max_distance query parameters.
 func HandleGetSimilarMealTemplates(e *core.RequestEvent) error {
 	mealID := e.Request.PathValue("id")
 
@@ -24,45 +33,45 @@ func HandleGetSimilarMealTemplates(e *core.RequestEvent) error {
 		return apis.NewForbiddenError("User not authorized to access this meal", nil)
 	}
 
-	imageNames := mealRecord.GetStringSlice("image")
-	if len(imageNames) == 0 {
-		return apis.NewBadRequestError("No image found for this meal", nil)
-	}
+	query := e.Request.URL.Query()
 
-	path := mealRecord.BaseFilesPath() + "/" + imageNames[0]
-	fsys, err := e.App.NewFilesystem()
+	page, limit, err := parseSimilarPaging(query, defaultSimilarLimit)
 	if err != nil {
-		return apis.NewInternalServerError("Could not create filesystem", err)
+		return err
 	}
 
-	imageFile, err := fsys.GetReader(path)
-	if err != nil {
-		return apis.NewBadRequestError("Could not read image", err)
+	var maxDistance float64
+	if raw := query.Get("max_distance"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed <= 0 {
+			return apis.NewBadRequestError("Invalid max_distance", err)
+		}
+		maxDistance = parsed
 	}
 
-	defer imageFile.Close()
-	defer fsys.Close()
-
-	var c ai.Embedder = clip.New()
-
-	rawEmbedding, err := c.GenerateEmbeddings(imageFile)
+	set, err := FindActiveVectorSet(e.App)
 	if err != nil {
-		slog.Error("Failed to generate image embedding", "error", err)
-		return apis.NewBadRequestError("Could not analyze image", err)
+		return apis.NewInternalServerError("Meal vectors are not set up", err)
 	}
 
-	mealVector, err := sqlite_vec.SerializeFloat32(rawEmbedding)
+	var stored struct {
+		Embedding []byte `db:"embedding"`
+	}
+	err = e.App.DB().NewQuery("SELECT embedding FROM {{" + set.Name + "}} WHERE meal_template_id = {:id} AND user_id = {:userId}").Bind(dbx.Params{
+		"id":     mealID,
+		"userId": e.Auth.Id,
+	}).One(&stored)
 	if err != nil {
-		slog.Error("Failed to serialize image embedding", "error", err)
-		return apis.NewBadRequestError("Could not process image", err)
+		return apis.NewNotFoundError("This meal has not been analyzed yet", err)
 	}
 
-	similarMeals, err := findSimilarMeals(e.App, mealVector, mealID, 3)
+	result, err := findSimilarMeals(e.App, set, stored.Embedding, e.Auth.Id, mealID, page, limit, maxDistance)
 	if err != nil {
+		slog.Error("Failed to find similar meals", "recordId", mealID, "error", err)
 		return apis.NewBadRequestError("Could not find similar meals", err)
 	}
 
-	return e.JSON(200, similarMeals)
+	return e.JSON(200, result)
 }
 
 func HandlePostMealLink(e *core.RequestEvent) error {
@@ -103,6 +112,101 @@ func HandlePostMealLink(e *core.RequestEvent) error {
 	})
 }
 
+// ApplyMealMatch copies the nutrition of an earlier meal showing the same
+// dish and adds the record to that meal's group. The record is not saved.
+func ApplyMealMatch(app core.App, record, match *core.Record) {
+	record.Set("name", match.GetString("name"))
+	record.Set("ai_description", match.GetString("ai_description"))
+	record.Set("total_calories", match.GetInt("total_calories"))
+	record.Set("calorie_uncertainty_percent", match.GetInt("calorie_uncertainty_percent"))
+	record.Set("total_protein_g", match.GetInt("total_protein_g"))
+	record.Set("protein_uncertainty_percent", match.GetInt("protein_uncertainty_percent"))
+	record.Set("total_carbs_g", match.GetInt("total_carbs_g"))
+	record.Set("carbs_uncertainty_percent", match.GetInt("carbs_uncertainty_percent"))
+	record.Set("total_fat_g", match.GetInt("total_fat_g"))
+	record.Set("fat_uncertainty_percent", match.GetInt("fat_uncertainty_percent"))
+	record.Set("meal_type", match.GetString("meal_type"))
+	record.Set("processing_status", "completed")
+
+	if match.GetString("linked_meal_template_id") != "" {
+		record.Set("linked_meal_template_id", match.GetString("linked_meal_template_id"))
+	} else if match.GetBool("is_primary_in_group") {
+		record.Set("linked_meal_template_id", match.Id)
+	} else {
+		match.Set("is_primary_in_group", true)
+		if err := app.Save(match); err != nil {
+			slog.Error("Failed to make similar meal primary", "error", err)
+		} else {
+			record.Set("linked_meal_template_id", match.Id)
+			slog.Info("Auto-linked new meal to similar meal", "newMeal", record.Id, "primaryMeal", match.Id)
+		}
+	}
+}
+
+func findSuggestedMeal(e *core.RequestEvent) (*core.Record, error) {
+	mealRecord, err := e.App.FindRecordById(types.COL_MEAL_TEMPLATES, e.Request.PathValue("id"))
+	if err != nil {
+		return nil, apis.NewNotFoundError("Meal template not found", err)
+	}
+
+	if mealRecord.GetString("user") != e.Auth.Id {
+		return nil, apis.NewForbiddenError("Access denied", nil)
+	}
+
+	if mealRecord.GetString("suggested_meal_template_id") == "" {
+		return nil, apis.NewBadRequestError("This meal has no suggested match", nil)
+	}
+
+	return mealRecord, nil
+}
+
+func clearMealSuggestion(record *core.Record) {
+	record.Set("suggested_meal_template_id", "")
+	record.Set("suggested_match_distance", 0)
+}
+
+// HandlePostMealSuggestionConfirm replaces the analyzed nutrition with the
+// suggested match's and links the meals.
+func HandlePostMealSuggestionConfirm(e *core.RequestEvent) error {
+	mealRecord, err := findSuggestedMeal(e)
+	if err != nil {
+		return err
+	}
+
+	match, err := e.App.FindRecordById(types.COL_MEAL_TEMPLATES, mealRecord.GetString("suggested_meal_template_id"))
+	if err != nil || match.GetString("user") != e.Auth.Id {
+		return apis.NewNotFoundError("Suggested meal not found", err)
+	}
+
+	ApplyMealMatch(e.App, mealRecord, match)
+	clearMealSuggestion(mealRecord)
+
+	if err := e.App.Save(mealRecord); err != nil {
+		return apis.NewBadRequestError("Failed to confirm match", err)
+	}
+
+	slog.Info("Confirmed suggested match", "recordId", mealRecord.Id, "matchId", match.Id)
+
+	return e.JSON(200, mealRecord)
+}
+
+// HandlePostMealSuggestionReject keeps the analyzed nutrition and drops the
+// suggestion.
+func HandlePostMealSuggestionReject(e *core.RequestEvent) error {
+	mealRecord, err := findSuggestedMeal(e)
+	if err != nil {
+		return err
+	}
+
+	clearMealSuggestion(mealRecord)
+
+	if err := e.App.Save(mealRecord); err != nil {
+		return apis.NewBadRequestError("Failed to reject match", err)
+	}
+
+	return e.JSON(200, mealRecord)
+}
+
 func HandlePostMealHide(e *core.RequestEvent) error {
 	mealID := e.Request.PathValue("id")
 
@@ -152,67 +256,172 @@ func HandlePostMealUnhide(e *core.RequestEvent) error {
 	})
 }
 
-func findSimilarMeals(app core.App, mealVector []byte, mealID string, limit int) ([]types.SimilarMeal, error) {
-	var matches []struct {
-		MealTemplateID string  `db:"meal_template_id"`
-		Distance       float32 `db:"distance"`
+// parseSimilarPaging reads the page and limit query parameters shared by
+// the similar meals and search endpoints.
+func parseSimilarPaging(query url.Values, defaultLimit int) (int, int, error) {
+	limit := defaultLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxSimilarLimit {
+			return 0, 0, apis.NewBadRequestError("Invalid limit, expected 1 to 50", err)
+		}
+		limit = parsed
 	}
 
-	err := app.DB().NewQuery(`
-		SELECT meal_template_id, distance
-		FROM meal_image_vectors,
-		WHERE embedding MATCH {:mealVector} AND k = {:limit} AND meal_template_id != {:mealID}
-		LIMIT {:limit}
-	`).Bind(dbx.Params{"mealVector": mealVector, "limit": limit, "mealID": mealID}).All(&matches)
+	page := 1
+	if raw := query.Get("page"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return 0, 0, apis.NewBadRequestError("Invalid page", err)
+		}
+		page = parsed
+	}
 
+	// the page, the next page check and the meal itself must fit into k
+	if page*limit+2 > maxSimilarK {
+		return 0, 0, apis.NewBadRequestError("Page is beyond the search limit", nil)
+	}
+
+	return page, limit, nil
+}
+
+// findSimilarMeals pages through the user's analyzed meals nearest to the
+// given vector. A max distance of 0 means no limit, an empty meal id
+// excludes nothing.
+func findSimilarMeals(app core.App, set types.VectorSet, mealVector []byte, userID, mealID string, page, limit int, maxDistance float64) (types.SimilarMealsPage, error) {
+	result := types.SimilarMealsPage{
+		Page:  page,
+		Limit: limit,
+		Items: []types.SimilarMeal{},
+	}
+
+	offset := (page - 1) * limit
+
+	// one extra to tell whether there is a next page
+	matches, err := findNearestMeals(app, set, mealVector, userID, mealID, offset, limit+1, maxDistance)
 	if err != nil {
-		return nil, err
+		return result, err
 	}
 
-	if len(matches) == 0 {
-		return []types.SimilarMeal{}, nil
+	if len(matches) > limit {
+		result.HasMore = true
+		matches = matches[:limit]
 	}
 
-	var mealIDs []any
-	for _, match := range matches {
-		mealIDs = append(mealIDs, match.MealTemplateID)
+	ids := make([]string, len(matches))
+	distances := make(map[string]float32, len(matches))
+	for i, match := range matches {
+		ids[i] = match.MealTemplateID
+		distances[match.MealTemplateID] = match.Distance
 	}
 
-	var meals []types.SimilarMeal
-	err = app.DB().Select("id", "name", "total_calories", "total_protein_g", "total_carbs_g", "total_fat_g", "ai_description", "created").
-		From(types.COL_MEAL_TEMPLATES).
-		Where(dbx.In("id", mealIDs...)).
-		AndWhere(dbx.HashExp{"processing_status": "completed"}).
-		OrderBy("created DESC").
-		All(&meals)
+	meals, err := loadSimilarMeals(app, ids)
+	if err != nil {
+		return result, err
+	}
 
+	for _, meal := range meals {
+		meal.Distance = distances[meal.ID]
+		result.Items = append(result.Items, meal)
+	}
+
+	return result, nil
+}
+
+type vectorMatch struct {
+	MealTemplateID string  `db:"meal_template_id"`
+	Distance       float32 `db:"distance"`
+}
+
+// findNearestMeals runs the KNN search over the user's analyzed meals in the
+// given vector set, skipping offset matches and returning at most count.
+func findNearestMeals(app core.App, set types.VectorSet, mealVector []byte, userID, mealID string, offset, count int, maxDistance float64) ([]vectorMatch, error) {
+	// the KNN runs before the join drops meals that aren't analyzed, e.g.
+	// ones being re-analyzed that keep their vector, so fetch that many more
+	var unfinished int
+	if err := app.DB().Select("COUNT(*)").From(types.COL_MEAL_TEMPLATES).Where(dbx.And(
+		dbx.HashExp{"user": userID},
+		dbx.Not(dbx.HashExp{"processing_status": "completed"}),
+	)).Row(&unfinished); err != nil {
+		return nil, err
+	}
+
+	// one extra for the meal itself
+	k := min(offset+count+1+unfinished, maxSimilarK)
+
+	distanceFilter := ""
+	if maxDistance > 0 {
+		distanceFilter = "AND v.distance <= {:maxDistance}"
+	}
+
+	var matches []vectorMatch
+
+	err := app.DB().NewQuery(`
+		SELECT v.meal_template_id, v.distance
+		FROM (
+			SELECT meal_template_id, distance
+			FROM {{` + set.Name + `}}
+			WHERE embedding MATCH {:mealVector} AND k = {:k} AND user_id = {:userID}
+		) v
+		JOIN meal_templates t ON t.id = v.meal_template_id
+		WHERE v.meal_template_id != {:mealID} AND t.processing_status = 'completed' ` + distanceFilter + `
+		ORDER BY v.distance
+		LIMIT {:limit} OFFSET {:offset}
+	`).Bind(dbx.Params{
+		"mealVector":  mealVector,
+		"k":           k,
+		"userID":      userID,
+		"mealID":      mealID,
+		"maxDistance": maxDistance,
+		"limit":       count,
+		"offset":      offset,
+	}).All(&matches)
+
+	return matches, err
+}
+
+// loadSimilarMeals loads the given meal templates in the given order.
+func loadSimilarMeals(app core.App, ids []string) ([]types.SimilarMeal, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	records, err := app.FindRecordsByIds(types.COL_MEAL_TEMPLATES, ids)
 	if err != nil {
 		return nil, err
 	}
 
-	// Add distance information and create image URLs
-	mealMap := make(map[string]*types.SimilarMeal)
-	for i := range meals {
-		mealMap[meals[i].ID] = &meals[i]
+	recordMap := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		recordMap[record.Id] = record
 	}
 
-	var result []types.SimilarMeal
-	for _, match := range matches {
-		if meal, exists := mealMap[match.MealTemplateID]; exists {
-			meal.Distance = match.Distance
+	meals := make([]types.SimilarMeal, 0, len(ids))
+	for _, id := range ids {
+		record, ok := recordMap[id]
+		if !ok {
+			continue
+		}
 
-			// Get image URL - we'll need the actual record for this
-			record, err := app.FindRecordById(types.COL_MEAL_TEMPLATES, meal.ID)
-			if err == nil {
-				imageFiles := record.GetStringSlice("image")
-				if len(imageFiles) > 0 {
-					meal.ImageURL = app.Settings().Meta.AppURL + "/api/files/" + record.Collection().Name + "/" + record.Id + "/" + imageFiles[0]
-				}
-			}
+		meal := types.SimilarMeal{
+			ID:                   record.Id,
+			Name:                 record.GetString("name"),
+			TotalCalories:        record.GetFloat("total_calories"),
+			TotalProteinG:        record.GetFloat("total_protein_g"),
+			TotalCarbsG:          record.GetFloat("total_carbs_g"),
+			TotalFatG:            record.GetFloat("total_fat_g"),
+			AiDescription:        record.GetString("ai_description"),
+			LinkedMealTemplateID: record.GetString("linked_meal_template_id"),
+			IsPrimaryInGroup:     record.GetBool("is_primary_in_group"),
+			Created:              record.GetString("created"),
+		}
 
-			result = append(result, *meal)
+		if imageFiles := record.GetStringSlice("image"); len(imageFiles) > 0 {
+			meal.ImageURL = app.Settings().Meta.AppURL + "/api/files/" + record.Collection().Name + "/" + record.Id + "/" + imageFiles[0]
 		}
+
+		meals = append(meals, meal)
 	}
 
-	return result, nil
+	return meals, nil
 }
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	EXPORT_FORMAT_CSV  = "csv"
+	EXPORT_FORMAT_JSON = "json"
+)
+
+// BuildExport collects the user's diary between the given local days, both
+// inclusive. Meals use the same effective values as the diary, hidden and
+// unanalyzed entries are left out.
+func BuildExport(app core.App, userID string, fromDay, toDay time.Time) (types.DiaryExport, error) {
+	loc := utils.UserLocation(app, userID)
+	from, _ := utils.DayBounds(fromDay, loc)
+	_, to := utils.DayBounds(toDay, loc)
+
+	export := types.DiaryExport{
+		From:       from.Format(utils.DateLayout),
+		To:         toDay.Format(utils.DateLayout),
+		Timezone:   loc.String(),
+		Meals:      []types.ExportMeal{},
+		Activities: []types.ExportActivity{},
+	}
+
+	entries, err := loadMealEntries(app, userID, from, to)
+	if err != nil {
+		return export, err
+	}
+
+	for _, entry := range entries {
+		multiplier := entry.PortionMultiplier
+		if multiplier == 0 {
+			multiplier = 1
+		}
+
+		export.Meals = append(export.Meals, types.ExportMeal{
+			ID:                entry.ID,
+			ConsumedAt:        parseDBTime(entry.ConsumedAt).In(loc),
+			MealSlot:          entry.MealSlot,
+			MealTemplateID:    entry.MealID,
+			Name:              entry.Name,
+			PortionMultiplier: multiplier,
+			MacroTotals:       roundMacros(entry.effective()),
+		})
+	}
+
+	activities, err := loadActivities(app, userID, from, to)
+	if err != nil {
+		return export, err
+	}
+
+	for _, activity := range activities {
+		export.Activities = append(export.Activities, types.ExportActivity{
+			ID:              activity.ID,
+			StartedAt:       parseDBTime(activity.StartedAt).In(loc),
+			ActivityType:    activity.ActivityType,
+			Name:            activity.CustomName,
+			Steps:           activity.Steps,
+			DurationMinutes: activity.DurationMinutes,
+			DistanceKm:      activity.DistanceKm,
+			AvgHeartRate:    activity.AvgHeartRate,
+			CaloriesBurned:  activity.CaloriesBurned,
+		})
+	}
+
+	return export, nil
+}
+
+// WriteExport writes the export as JSON, or as a zip with one CSV file per
+// sheet.
+func WriteExport(w io.Writer, export types.DiaryExport, format string) error {
+	if format == EXPORT_FORMAT_JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(export)
+	}
+
+	archive := zip.NewWriter(w)
+
+	meals := [][]string{{
+		"id", "consumed_at", "meal_slot", "meal_template_id", "name", "portion_multiplier",
+		"calories", "protein_g", "carbs_g", "fat_g",
+	}}
+	for _, m := range export.Meals {
+		meals = append(meals, []string{
+			m.ID, m.ConsumedAt.Format(time.RFC3339), m.MealSlot, m.MealTemplateID, m.Name, formatFloat(m.PortionMultiplier),
+			formatFloat(m.Calories), formatFloat(m.ProteinG), formatFloat(m.CarbsG), formatFloat(m.FatG),
+		})
+	}
+
+	activities := [][]string{{
+		"id", "started_at", "activity_type", "name", "steps", "duration_minutes",
+		"distance_km", "avg_heart_rate", "calories_burned",
+	}}
+	for _, a := range export.Activities {
+		activities = append(activities, []string{
+			a.ID, a.StartedAt.Format(time.RFC3339), a.ActivityType, a.Name, strconv.Itoa(a.Steps), strconv.Itoa(a.DurationMinutes),
+			formatFloat(a.DistanceKm), formatFloat(a.AvgHeartRate), formatFloat(a.CaloriesBurned),
+		})
+	}
+
+	if err := writeCSV(archive, "meals.csv", meals); err != nil {
+		return err
+	}
+	if err := writeCSV(archive, "activities.csv", activities); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeCSV(archive *zip.Writer, name string, rows [][]string) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(f)
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+
+	return writer.Error()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// ExportFileName returns the download name for an export.
+func ExportFileName(export types.DiaryExport, format string) string {
+	ext := "zip"
+	if format == EXPORT_FORMAT_JSON {
+		ext = "json"
+	}
+
+	return fmt.Sprintf("caloriemate-%s-%s.%s", export.From, export.To, ext)
+}
+
+// ParseExportRange parses the optional from and to days, an empty from
+// exports everything up to to, which defaults to today.
+func ParseExportRange(from, to string, loc *time.Location) (time.Time, time.Time, error) {
+	toDay := time.Now().In(loc)
+	if to != "" {
+		parsed, err := time.Parse(utils.DateLayout, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid to date, expected YYYY-MM-DD")
+		}
+		toDay = parsed
+	}
+
+	fromDay := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	if from != "" {
+		parsed, err := time.Parse(utils.DateLayout, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid from date, expected YYYY-MM-DD")
+		}
+		fromDay = parsed
+	}
+
+	if toDay.Before(fromDay) {
+		return time.Time{}, time.Time{}, errors.New("the from date must not be after the to date")
+	}
+
+	return fromDay, toDay, nil
+}
+
+func HandleGetExport(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+
+	format := query.Get("format")
+	switch format {
+	case "":
+		format = EXPORT_FORMAT_CSV
+	case EXPORT_FORMAT_CSV, EXPORT_FORMAT_JSON:
+	default:
+		return apis.NewBadRequestError("Invalid format, expected csv or json", nil)
+	}
+
+	loc := utils.UserLocation(e.App, e.Auth.Id)
+	fromDay, toDay, err := ParseExportRange(query.Get("from"), query.Get("to"), loc)
+	if err != nil {
+		return apis.NewBadRequestError("Invalid date range: "+err.Error(), err)
+	}
+
+	export, err := BuildExport(e.App, e.Auth.Id, fromDay, toDay)
+	if err != nil {
+		return apis.NewBadRequestError("Could not build export", err)
+	}
+
+	contentType := "application/zip"
+	if format == EXPORT_FORMAT_JSON {
+		contentType = "application/json"
+	}
+
+	e.Response.Header().Set("Content-Type", contentType)
+	e.Response.Header().Set("Content-Disposition", `attachment; filename="`+ExportFileName(export, format)+`"`)
+	e.Response.WriteHeader(200)
+
+	return WriteExport(e.Response, export, format)
+}
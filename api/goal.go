@@ -0,0 +1,78 @@
+package api
+
+import (
+	"math"
+	"time"
+
+	"github.com/ignoxx/caloriemate/nutrition"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// a plan is on track while the trend is within this much of the projection
+const goalTolerancePercent = 1.0
+
+func buildGoalProgress(app core.App, record *core.Record, now time.Time) (types.GoalProgress, error) {
+	plan := nutrition.GoalPlanFromRecord(record)
+	loc := utils.UserLocation(app, record.GetString("user"))
+
+	progress := types.GoalProgress{
+		PlanID:            record.Id,
+		StartDate:         plan.StartDate.In(loc).Format(utils.DateLayout),
+		StartWeightKg:     plan.StartWeightKg,
+		TargetDate:        plan.TargetDate.In(loc).Format(utils.DateLayout),
+		TargetWeightKg:    plan.TargetWeightKg,
+		PlannedRateKg:     record.GetFloat("weekly_rate_kg"),
+		DailyCalorieDelta: record.GetFloat("daily_calorie_delta"),
+		Warning:           record.GetString("warning"),
+		ProjectedKg:       math.Round(plan.ProjectedWeight(now)*100) / 100,
+	}
+
+	trend, err := buildWeightTrend(app, record.GetString("user"), plan.StartDate)
+	if err != nil {
+		return progress, err
+	}
+
+	// without weigh-ins since the start there is nothing to compare against
+	if len(trend.Points) == 0 {
+		progress.TrendKg = plan.StartWeightKg
+		progress.OnTrack = true
+		progress.EstimatedWeeksLeft = nutrition.WeeksAtRate(plan.StartWeightKg, plan.TargetWeightKg, plan.WeeklyRate())
+		return progress, nil
+	}
+
+	progress.TrendKg = trend.TrendKg
+	progress.ActualRateKg = trend.WeeklyRateKg
+	progress.DifferenceKg = math.Round((trend.TrendKg-progress.ProjectedKg)*100) / 100
+
+	// being ahead of the plan counts as on track too
+	behind := progress.DifferenceKg
+	if plan.TargetWeightKg > plan.StartWeightKg {
+		behind = -behind
+	}
+	progress.OnTrack = behind <= plan.StartWeightKg*goalTolerancePercent/100
+
+	weeks := nutrition.WeeksAtRate(trend.TrendKg, plan.TargetWeightKg, trend.WeeklyRateKg)
+	if weeks > 0 {
+		weeks = math.Round(weeks*10) / 10
+	}
+	progress.EstimatedWeeksLeft = weeks
+
+	return progress, nil
+}
+
+func HandleGetGoalProgress(e *core.RequestEvent) error {
+	record, err := nutrition.FindActiveGoalPlan(e.App, e.Auth.Id)
+	if err != nil {
+		return apis.NewNotFoundError("No active goal plan", err)
+	}
+
+	progress, err := buildGoalProgress(e.App, record, time.Now())
+	if err != nil {
+		return apis.NewBadRequestError("Could not build goal progress", err)
+	}
+
+	return e.JSON(200, progress)
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"math"
+	"time"
+
+	"github.com/ignoxx/caloriemate/nutrition"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	GRANULARITY_DAY   = "day"
+	GRANULARITY_WEEK  = "week"
+	GRANULARITY_MONTH = "month"
+
+	// maxReportDays keeps a single report request from scanning years of data
+	maxReportDays = 731
+
+	// a day counts as on target when intake is within 10% of the target
+	adherenceTolerance = 0.1
+)
+
+type dayTotals struct {
+	intake   types.MacroTotals
+	targets  types.MacroTotals
+	activity types.ActivityTotals
+	logged   bool
+	training bool
+}
+
+// periodStart returns the first day of the period containing day. Weeks
+// start on Monday.
+func periodStart(day time.Time, granularity string) time.Time {
+	switch granularity {
+	case GRANULARITY_WEEK:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case GRANULARITY_MONTH:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	default:
+		return day
+	}
+}
+
+func nextPeriodStart(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case GRANULARITY_WEEK:
+		return start.AddDate(0, 0, 7)
+	case GRANULARITY_MONTH:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+func summarizePeriod(days []time.Time, totals map[string]*dayTotals) types.PeriodSummary {
+	summary := types.PeriodSummary{
+		Start: days[0].Format(utils.DateLayout),
+		End:   days[len(days)-1].Format(utils.DateLayout),
+		Days:  len(days),
+	}
+
+	var targets types.MacroTotals
+	for _, day := range days {
+		t := totals[day.Format(utils.DateLayout)]
+
+		summary.Activity.CaloriesBurned += t.activity.CaloriesBurned
+		summary.Activity.Steps += t.activity.Steps
+		summary.Activity.DurationMinutes += t.activity.DurationMinutes
+		summary.Activity.Sessions += t.activity.Sessions
+
+		// days without any logged meal are unknown, not fasted
+		if !t.logged {
+			continue
+		}
+
+		summary.LoggedDays++
+		summary.Total = summary.Total.Add(t.intake)
+		targets = targets.Add(t.targets)
+
+		budget := t.targets.Calories + t.activity.CaloriesBurned
+		if t.targets.Calories > 0 && math.Abs(t.intake.Calories-budget) <= t.targets.Calories*adherenceTolerance {
+			summary.Adherence.CalorieDaysOnTarget++
+		}
+		if t.targets.ProteinG > 0 && t.intake.ProteinG >= t.targets.ProteinG*(1-adherenceTolerance) {
+			summary.Adherence.ProteinDaysOnTarget++
+		}
+	}
+
+	if summary.LoggedDays > 0 {
+		n := float64(summary.LoggedDays)
+		summary.AverageIntake = roundMacros(summary.Total.Scale(1 / n))
+		summary.AverageTargets = roundMacros(targets.Scale(1 / n))
+		summary.Adherence.CaloriePercent = percent(float64(summary.Adherence.CalorieDaysOnTarget), n)
+		summary.Adherence.ProteinPercent = percent(float64(summary.Adherence.ProteinDaysOnTarget), n)
+	}
+
+	summary.MacroSplit = macroSplit(summary.Total)
+	summary.Total = roundMacros(summary.Total)
+
+	return summary
+}
+
+// macroSplit returns the share of energy from each macro, using 4/4/9 kcal
+// per gram rather than the logged calories which rarely add up exactly.
+func macroSplit(m types.MacroTotals) types.MacroSplit {
+	protein := m.ProteinG * 4
+	carbs := m.CarbsG * 4
+	fat := m.FatG * 9
+	total := protein + carbs + fat
+
+	return types.MacroSplit{
+		ProteinPercent: percent(protein, total),
+		CarbsPercent:   percent(carbs, total),
+		FatPercent:     percent(fat, total),
+	}
+}
+
+func percent(part, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+
+	return math.Round(part/total*1000) / 10
+}
+
+// loadDayTotals buckets the user's meals and activities in [from, to) by
+// local calendar day and resolves each day's targets from the schedule.
+func loadDayTotals(app core.App, userID string, from, to time.Time, loc *time.Location) (map[string]*dayTotals, error) {
+	entries, err := loadMealEntries(app, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	activities, err := loadActivities(app, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := loadTargetPlan(app, userID)
+
+	totals := make(map[string]*dayTotals)
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		totals[day.Format(utils.DateLayout)] = &dayTotals{}
+	}
+
+	for _, entry := range entries {
+		t, ok := totals[parseDBTime(entry.ConsumedAt).In(loc).Format(utils.DateLayout)]
+		if !ok {
+			continue
+		}
+
+		t.intake = t.intake.Add(entry.effective())
+		t.logged = true
+	}
+
+	for _, activity := range activities {
+		t, ok := totals[parseDBTime(activity.StartedAt).In(loc).Format(utils.DateLayout)]
+		if !ok {
+			continue
+		}
+
+		t.activity.CaloriesBurned += activity.CaloriesBurned
+		t.activity.Steps += activity.Steps
+		t.activity.DurationMinutes += activity.DurationMinutes
+		t.activity.Sessions++
+		if nutrition.IsTrainingActivity(plan.schedule, activity.ActivityType) {
+			t.training = true
+		}
+	}
+
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		t := totals[day.Format(utils.DateLayout)]
+		t.targets = plan.forDay(day, t.training)
+	}
+
+	return totals, nil
+}
+
+func buildRangeSummary(app core.App, userID string, fromDay, toDay time.Time, granularity string, loc *time.Location) (types.RangeSummary, error) {
+	from, _ := utils.DayBounds(fromDay, loc)
+	_, to := utils.DayBounds(toDay, loc)
+
+	totals, err := loadDayTotals(app, userID, from, to, loc)
+	if err != nil {
+		return types.RangeSummary{}, err
+	}
+
+	var allDays []time.Time
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		allDays = append(allDays, day)
+	}
+
+	summary := types.RangeSummary{
+		From:        from.Format(utils.DateLayout),
+		To:          toDay.Format(utils.DateLayout),
+		Timezone:    loc.String(),
+		Granularity: granularity,
+		Periods:     []types.PeriodSummary{},
+		Overall:     summarizePeriod(allDays, totals),
+	}
+
+	for start := from; start.Before(to); {
+		end := nextPeriodStart(periodStart(start, granularity), granularity)
+
+		var days []time.Time
+		for day := start; day.Before(end) && day.Before(to); day = day.AddDate(0, 0, 1) {
+			days = append(days, day)
+		}
+
+		summary.Periods = append(summary.Periods, summarizePeriod(days, totals))
+		start = end
+	}
+
+	return summary, nil
+}
+
+func HandleGetRangeSummary(e *core.RequestEvent) error {
+	loc := utils.UserLocation(e.App, e.Auth.Id)
+	query := e.Request.URL.Query()
+
+	granularity := query.Get("granularity")
+	switch granularity {
+	case "":
+		granularity = GRANULARITY_DAY
+	case GRANULARITY_DAY, GRANULARITY_WEEK, GRANULARITY_MONTH:
+	default:
+		return apis.NewBadRequestError("Invalid granularity, expected day, week or month", nil)
+	}
+
+	today := time.Now().In(loc)
+	toDay := today
+	if to := query.Get("to"); to != "" {
+		parsed, err := time.Parse(utils.DateLayout, to)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid to date, expected YYYY-MM-DD", err)
+		}
+		toDay = parsed
+	}
+
+	fromDay := toDay.AddDate(0, 0, -6)
+	if from := query.Get("from"); from != "" {
+		parsed, err := time.Parse(utils.DateLayout, from)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid from date, expected YYYY-MM-DD", err)
+		}
+		fromDay = parsed
+	}
+
+	fromDate := time.Date(fromDay.Year(), fromDay.Month(), fromDay.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(toDay.Year(), toDay.Month(), toDay.Day(), 0, 0, 0, 0, time.UTC)
+	if toDate.Before(fromDate) {
+		return apis.NewBadRequestError("The from date must not be after the to date", nil)
+	}
+	if toDate.Sub(fromDate) > maxReportDays*24*time.Hour {
+		return apis.NewBadRequestError("Date range too large", nil)
+	}
+
+	summary, err := buildRangeSummary(e.App, e.Auth.Id, fromDay, toDay, granularity, loc)
+	if err != nil {
+		return apis.NewBadRequestError("Could not build report", err)
+	}
+
+	return e.JSON(200, summary)
+}
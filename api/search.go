@@ -0,0 +1,225 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"unicode"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+	"github.com/ignoxx/caloriemate/ai"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchQuery     = 200
+	// damps the weight of the top ranks, 60 is the usual choice for
+	// reciprocal rank fusion
+	rrfK = 60
+)
+
+// DefaultImageSearchMargin is how far beyond the best image hit, as a share
+// of its distance, further hits are still kept. CLIP text to image distances
+// of one query sit in a narrow band, so the cut is relative to the best hit
+// rather than absolute. It keeps a query without a good photo match from
+// pulling the whole library into the results.
+const DefaultImageSearchMargin = 0.1
+
+// HandleGetMealSearch returns a handler that finds the caller's meals by
+// keyword and by what is on the photo. Keyword hits come from the full-text
+// index over name and descriptions, image hits from matching the query's
+// text embedding against the image vectors, so "ramen" also finds a meal
+// the AI called "Tonkotsu Noodle Soup". Both rankings are merged with
+// reciprocal rank fusion. If the embedder is unavailable or can't embed
+// text the keyword hits are returned on their own. Image hits further than
+// imageMargin beyond the best one are dropped, 0 keeps them all.
+func HandleGetMealSearch(imgLlm ai.Embedder, imageMargin float64) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		query := e.Request.URL.Query()
+
+		q := strings.TrimSpace(query.Get("q"))
+		if q == "" {
+			return apis.NewBadRequestError("Missing search query", nil)
+		}
+		if len(q) > maxSearchQuery {
+			return apis.NewBadRequestError("Search query too long", nil)
+		}
+
+		page, limit, err := parseSimilarPaging(query, defaultSearchLimit)
+		if err != nil {
+			return err
+		}
+
+		// every hit up to the end of the page could end up on it after fusion
+		window := page*limit + 1
+
+		keywordIDs, err := findKeywordMeals(e.App, e.Auth.Id, q, window)
+		if err != nil {
+			slog.Error("Failed to search meal texts", "userId", e.Auth.Id, "error", err)
+			return apis.NewBadRequestError("Could not search meals", err)
+		}
+
+		imageMatches, err := findImageMeals(e.App, imgLlm, e.Auth.Id, q, window, imageMargin)
+		if err != nil && !errors.Is(err, ai.ErrTextNotSupported) {
+			slog.Warn("Image search unavailable, using keywords only", "error", err)
+		}
+
+		result, err := fuseMealSearch(e.App, keywordIDs, imageMatches, page, limit)
+		if err != nil {
+			slog.Error("Failed to load meal search results", "userId", e.Auth.Id, "error", err)
+			return apis.NewBadRequestError("Could not search meals", err)
+		}
+
+		return e.JSON(200, result)
+	}
+}
+
+// ftsQuery turns free text into an FTS5 query matching any of its words as
+// a prefix. Everything but letters and digits is dropped, so user input
+// can't inject FTS syntax.
+func ftsQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + word + `"*`
+	}
+
+	return strings.Join(terms, " OR ")
+}
+
+// findKeywordMeals returns the ids of the user's analyzed meals matching the
+// query, best first. The name weighs more than the descriptions.
+func findKeywordMeals(app core.App, userID, q string, count int) ([]string, error) {
+	match := ftsQuery(q)
+	if match == "" {
+		return nil, nil
+	}
+
+	var ids []string
+	err := app.DB().NewQuery(`
+		SELECT f.meal_template_id
+		FROM meal_templates_fts f
+		JOIN meal_templates t ON t.id = f.meal_template_id
+		WHERE meal_templates_fts MATCH {:match} AND f.user_id = {:userId} AND t.processing_status = 'completed'
+		ORDER BY bm25(meal_templates_fts, 0, 0, 10, 2, 1)
+		LIMIT {:count}
+	`).Bind(dbx.Params{
+		"match":  match,
+		"userId": userID,
+		"count":  count,
+	}).Column(&ids)
+
+	return ids, err
+}
+
+func findImageMeals(app core.App, imgLlm ai.Embedder, userID, q string, count int, margin float64) ([]vectorMatch, error) {
+	model, err := imgLlm.Model()
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := FindVectorSetForModel(app, model)
+	if err != nil {
+		return nil, err
+	}
+
+	rawEmbedding, err := imgLlm.GenerateTextEmbeddings(q)
+	if err != nil {
+		return nil, err
+	}
+
+	queryVector, err := sqlite_vec.SerializeFloat32(rawEmbedding)
+	if err != nil {
+		return nil, err
+	}
+
+	// text and image vectors are never close in absolute terms, so there is
+	// no fixed cutoff, only the distance relative to the best match counts
+	matches, err := findNearestMeals(app, set, queryVector, userID, "", 0, count, 0)
+	if err != nil || len(matches) == 0 || margin <= 0 {
+		return matches, err
+	}
+
+	cutoff := matches[0].Distance * float32(1+margin)
+	for i, match := range matches {
+		if match.Distance > cutoff {
+			return matches[:i], nil
+		}
+	}
+
+	return matches, nil
+}
+
+// fuseMealSearch merges the keyword and image rankings, scoring each meal
+// with the sum of 1/(rrfK+rank) over the rankings it appears in.
+func fuseMealSearch(app core.App, keywordIDs []string, imageMatches []vectorMatch, page, limit int) (types.MealSearchPage, error) {
+	result := types.MealSearchPage{
+		Page:  page,
+		Limit: limit,
+		Items: []types.MealSearchHit{},
+	}
+
+	hits := map[string]*types.MealSearchHit{}
+	var order []string
+
+	add := func(id string, rank int, source string) *types.MealSearchHit {
+		hit, ok := hits[id]
+		if !ok {
+			hit = &types.MealSearchHit{}
+			hits[id] = hit
+			order = append(order, id)
+		}
+		hit.Score += 1 / float64(rrfK+rank+1)
+		hit.Sources = append(hit.Sources, source)
+		return hit
+	}
+
+	for rank, id := range keywordIDs {
+		add(id, rank, types.SEARCH_SOURCE_KEYWORD)
+	}
+
+	distances := map[string]float32{}
+	for rank, match := range imageMatches {
+		add(match.MealTemplateID, rank, types.SEARCH_SOURCE_IMAGE)
+		distances[match.MealTemplateID] = match.Distance
+	}
+
+	// stable, so ties keep keyword hits first
+	sort.SliceStable(order, func(i, j int) bool {
+		return hits[order[i]].Score > hits[order[j]].Score
+	})
+
+	offset := (page - 1) * limit
+	if offset >= len(order) {
+		return result, nil
+	}
+
+	end := offset + limit
+	if end < len(order) {
+		result.HasMore = true
+	} else {
+		end = len(order)
+	}
+
+	meals, err := loadSimilarMeals(app, order[offset:end])
+	if err != nil {
+		return result, err
+	}
+
+	for _, meal := range meals {
+		hit := hits[meal.ID]
+		hit.SimilarMeal = meal
+		hit.Distance = distances[meal.ID]
+		result.Items = append(result.Items, *hit)
+	}
+
+	return result, nil
+}
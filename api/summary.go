@@ -0,0 +1,245 @@
+package api
+
+import (
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/ignoxx/caloriemate/nutrition"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	pbtypes "github.com/pocketbase/pocketbase/tools/types"
+)
+
+type mealEntry struct {
+	ID                string  `db:"id"`
+	MealID            string  `db:"meal"`
+	Name              string  `db:"name"`
+	ConsumedAt        string  `db:"consumed_at"`
+	MealSlot          string  `db:"meal_slot"`
+	PortionMultiplier float64 `db:"portion_multiplier"`
+	CalorieAdjustment float64 `db:"calorie_adjustment"`
+	ProteinAdjustment float64 `db:"protein_adjustment"`
+	CarbAdjustment    float64 `db:"carb_adjustment"`
+	FatAdjustment     float64 `db:"fat_adjustment"`
+	TotalCalories     float64 `db:"total_calories"`
+	TotalProteinG     float64 `db:"total_protein_g"`
+	TotalCarbsG       float64 `db:"total_carbs_g"`
+	TotalFatG         float64 `db:"total_fat_g"`
+}
+
+// effective applies the portion multiplier and manual adjustments to the
+// meal template's nutrition, the same way the diary displays it.
+func (m mealEntry) effective() types.MacroTotals {
+	multiplier := m.PortionMultiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+
+	return types.MacroTotals{
+		Calories: m.TotalCalories*multiplier + m.CalorieAdjustment,
+		ProteinG: m.TotalProteinG*multiplier + m.ProteinAdjustment,
+		CarbsG:   m.TotalCarbsG*multiplier + m.CarbAdjustment,
+		FatG:     m.TotalFatG*multiplier + m.FatAdjustment,
+	}
+}
+
+// loadMealEntries returns the user's visible, analyzed meals consumed in [from, to).
+func loadMealEntries(app core.App, userID string, from, to time.Time) ([]mealEntry, error) {
+	var entries []mealEntry
+
+	err := app.DB().NewQuery(`
+		SELECT
+			h.id AS id, h.meal AS meal, t.name AS name, h.consumed_at AS consumed_at, h.meal_slot AS meal_slot,
+			h.portion_multiplier AS portion_multiplier,
+			h.calorie_adjustment AS calorie_adjustment, h.protein_adjustment AS protein_adjustment,
+			h.carb_adjustment AS carb_adjustment, h.fat_adjustment AS fat_adjustment,
+			t.total_calories AS total_calories, t.total_protein_g AS total_protein_g,
+			t.total_carbs_g AS total_carbs_g, t.total_fat_g AS total_fat_g
+		FROM meal_history h
+		JOIN meal_templates t ON t.id = h.meal
+		WHERE h.user = {:user}
+			AND h.consumed_at >= {:from} AND h.consumed_at < {:to}
+			AND h.adjustments != 'hidden'
+			AND t.processing_status = 'completed'
+		ORDER BY h.consumed_at
+	`).Bind(dbx.Params{
+		"user": userID,
+		"from": utils.FormatDBTime(from),
+		"to":   utils.FormatDBTime(to),
+	}).All(&entries)
+
+	return entries, err
+}
+
+type activityEntry struct {
+	ID              string  `db:"id"`
+	ActivityType    string  `db:"activity_type"`
+	CustomName      string  `db:"custom_name"`
+	Steps           int     `db:"steps"`
+	DurationMinutes int     `db:"duration_minutes"`
+	DistanceKm      float64 `db:"distance_km"`
+	AvgHeartRate    float64 `db:"avg_heart_rate"`
+	CaloriesBurned  float64 `db:"calories_burned"`
+	StartedAt       string  `db:"started_at"`
+}
+
+// loadActivities returns the user's activities started in [from, to).
+func loadActivities(app core.App, userID string, from, to time.Time) ([]activityEntry, error) {
+	var activities []activityEntry
+
+	err := app.DB().Select("id", "activity_type", "custom_name", "steps", "duration_minutes", "distance_km", "avg_heart_rate", "calories_burned", "started_at").
+		From(types.COL_ACTIVITY_LOGS).
+		Where(dbx.HashExp{"user": userID}).
+		AndWhere(dbx.NewExp("started_at >= {:from} AND started_at < {:to}", dbx.Params{
+			"from": utils.FormatDBTime(from),
+			"to":   utils.FormatDBTime(to),
+		})).
+		OrderBy("started_at").
+		All(&activities)
+
+	return activities, err
+}
+
+// targetPlan holds the profile's base targets and the schedule resolving
+// them per day.
+type targetPlan struct {
+	base     types.MacroTotals
+	schedule *types.TargetSchedule
+}
+
+func loadTargetPlan(app core.App, userID string) targetPlan {
+	profile, err := app.FindFirstRecordByData(types.COL_USER_PROFILES, "user", userID)
+	if err != nil {
+		return targetPlan{}
+	}
+
+	schedule, err := nutrition.TargetScheduleFromRecord(profile)
+	if err != nil {
+		slog.Warn("Ignoring invalid target schedule", "error", err, "userId", userID)
+	}
+
+	return targetPlan{
+		base: types.MacroTotals{
+			Calories: profile.GetFloat("target_calories"),
+			ProteinG: profile.GetFloat("target_protein_g"),
+			CarbsG:   profile.GetFloat("target_carbs_g"),
+			FatG:     profile.GetFloat("target_fat_g"),
+		},
+		schedule: schedule,
+	}
+}
+
+func (p targetPlan) isTraining(activities []activityEntry) bool {
+	for _, activity := range activities {
+		if nutrition.IsTrainingActivity(p.schedule, activity.ActivityType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p targetPlan) forDay(day time.Time, training bool) types.MacroTotals {
+	return nutrition.DayTargets(p.base, p.schedule, day.Weekday(), training)
+}
+
+func parseDBTime(s string) time.Time {
+	dt, _ := pbtypes.ParseDateTime(s)
+	return dt.Time()
+}
+
+func roundMacros(m types.MacroTotals) types.MacroTotals {
+	return types.MacroTotals{
+		Calories: math.Round(m.Calories),
+		ProteinG: math.Round(m.ProteinG*10) / 10,
+		CarbsG:   math.Round(m.CarbsG*10) / 10,
+		FatG:     math.Round(m.FatG*10) / 10,
+	}
+}
+
+func buildDaySummary(app core.App, userID string, day time.Time, loc *time.Location) (types.DaySummary, error) {
+	from, to := utils.DayBounds(day, loc)
+
+	entries, err := loadMealEntries(app, userID, from, to)
+	if err != nil {
+		return types.DaySummary{}, err
+	}
+
+	activities, err := loadActivities(app, userID, from, to)
+	if err != nil {
+		return types.DaySummary{}, err
+	}
+
+	var burned float64
+	for _, activity := range activities {
+		burned += activity.CaloriesBurned
+	}
+
+	summary := types.DaySummary{
+		Date:           from.Format(utils.DateLayout),
+		Timezone:       loc.String(),
+		Slots:          make(map[types.MealSlot]types.SlotSummary, len(types.MealSlots)),
+		Meals:          len(entries),
+		CaloriesBurned: burned,
+	}
+
+	plan := loadTargetPlan(app, userID)
+	summary.TrainingDay = plan.isTraining(activities)
+	summary.Targets = plan.forDay(from, summary.TrainingDay)
+
+	for _, slot := range types.MealSlots {
+		summary.Slots[slot] = types.SlotSummary{}
+	}
+
+	for _, entry := range entries {
+		macros := entry.effective()
+		summary.Consumed = summary.Consumed.Add(macros)
+
+		slot := entry.MealSlot
+		if slot == "" {
+			slot = types.MEAL_SLOT_SNACK
+		}
+
+		slotSummary := summary.Slots[slot]
+		slotSummary.MacroTotals = slotSummary.MacroTotals.Add(macros)
+		slotSummary.Meals++
+		summary.Slots[slot] = slotSummary
+	}
+
+	// burned calories extend the calorie budget, macros are not affected
+	summary.Remaining = summary.Targets.Sub(summary.Consumed)
+	summary.Remaining.Calories += burned
+
+	summary.Consumed = roundMacros(summary.Consumed)
+	summary.Remaining = roundMacros(summary.Remaining)
+	for slot, slotSummary := range summary.Slots {
+		slotSummary.MacroTotals = roundMacros(slotSummary.MacroTotals)
+		summary.Slots[slot] = slotSummary
+	}
+
+	return summary, nil
+}
+
+func HandleGetDaySummary(e *core.RequestEvent) error {
+	loc := utils.UserLocation(e.App, e.Auth.Id)
+
+	day := time.Now().In(loc)
+	if date := e.Request.URL.Query().Get("date"); date != "" {
+		parsed, err := time.Parse(utils.DateLayout, date)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid date, expected YYYY-MM-DD", err)
+		}
+		day = parsed
+	}
+
+	summary, err := buildDaySummary(e.App, e.Auth.Id, day, loc)
+	if err != nil {
+		return apis.NewBadRequestError("Could not build daily summary", err)
+	}
+
+	return e.JSON(200, summary)
+}
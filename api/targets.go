@@ -0,0 +1,50 @@
+package api
+
+import (
+	"github.com/ignoxx/caloriemate/nutrition"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type targetsPreviewRequest struct {
+	Age            int     `json:"age"`
+	WeightKg       float64 `json:"weight_kg"`
+	HeightCm       float64 `json:"height_cm"`
+	Gender         string  `json:"gender"`
+	ActivityLevel  string  `json:"activity_level"`
+	Goal           string  `json:"goal"`
+	BodyFatPercent float64 `json:"body_fat_percent"`
+	BmrFormula     string  `json:"bmr_formula"`
+}
+
+// HandlePostTargetsPreview returns the targets a profile with these values
+// would get, so onboarding can show them before the profile exists. It is
+// public because onboarding runs before signup.
+func HandlePostTargetsPreview(e *core.RequestEvent) error {
+	var body targetsPreviewRequest
+	if err := e.BindBody(&body); err != nil {
+		return apis.NewBadRequestError("Invalid profile data", err)
+	}
+
+	profile := nutrition.Profile{
+		Age:            body.Age,
+		WeightKg:       body.WeightKg,
+		HeightCm:       body.HeightCm,
+		Gender:         body.Gender,
+		ActivityLevel:  body.ActivityLevel,
+		Goal:           body.Goal,
+		BodyFatPercent: body.BodyFatPercent,
+		Formula:        body.BmrFormula,
+	}
+
+	if !profile.Complete() {
+		return apis.NewBadRequestError("Age, weight and height are required", nil)
+	}
+
+	adjustment := nutrition.GoalAdjustment(profile.Goal)
+	if e.Auth != nil {
+		adjustment = nutrition.GoalAdjustmentFor(e.App, e.Auth.Id, profile.Goal)
+	}
+
+	return e.JSON(200, nutrition.TargetsWithAdjustment(profile, adjustment))
+}
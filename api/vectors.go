@@ -0,0 +1,40 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/ignoxx/caloriemate/ai"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func FindVectorSets(app core.App) ([]types.VectorSet, error) {
+	var sets []types.VectorSet
+	err := app.DB().NewQuery("SELECT name, model, dimensions, status FROM meal_vector_sets ORDER BY created").All(&sets)
+	return sets, err
+}
+
+func FindActiveVectorSet(app core.App) (types.VectorSet, error) {
+	var set types.VectorSet
+	err := app.DB().NewQuery("SELECT name, model, dimensions, status FROM meal_vector_sets WHERE status = {:status}").Bind(dbx.Params{
+		"status": types.VECTOR_SET_ACTIVE,
+	}).One(&set)
+	return set, err
+}
+
+// FindVectorSetForModel returns the active set if the model made it. A
+// vector of another model would be compared against meaningless neighbours,
+// so callers skip the similarity search until the vectors are reindexed.
+func FindVectorSetForModel(app core.App, model ai.EmbeddingModel) (types.VectorSet, error) {
+	set, err := FindActiveVectorSet(app)
+	if err != nil {
+		return set, err
+	}
+
+	if set.Model != model.Name || set.Dimensions != model.Dimensions {
+		return set, fmt.Errorf("vectors were made by %s, the embedder runs %s, run vectors reindex", set.Model, model.Name)
+	}
+
+	return set, nil
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ignoxx/caloriemate/nutrition"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultTrendDays = 90
+	maxTrendDays     = 730
+
+	// trendWarmup is loaded before the requested range so the first
+	// returned trend values are already settled
+	trendWarmup = 30 * 24 * time.Hour
+)
+
+type weightRow struct {
+	ID         string  `db:"id"`
+	WeightKg   float64 `db:"weight_kg"`
+	MeasuredAt string  `db:"measured_at"`
+}
+
+// loadWeightSamples returns the user's weigh-ins since from, oldest first.
+func loadWeightSamples(app core.App, userID string, from time.Time) ([]weightRow, []nutrition.WeightSample, error) {
+	var rows []weightRow
+
+	err := app.DB().Select("id", "weight_kg", "measured_at").
+		From(types.COL_WEIGHT_LOGS).
+		Where(dbx.HashExp{"user": userID}).
+		AndWhere(dbx.NewExp("measured_at >= {:from}", dbx.Params{"from": utils.FormatDBTime(from)})).
+		OrderBy("measured_at").
+		All(&rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	samples := make([]nutrition.WeightSample, len(rows))
+	for i, row := range rows {
+		samples[i] = nutrition.WeightSample{At: parseDBTime(row.MeasuredAt), WeightKg: row.WeightKg}
+	}
+
+	return rows, samples, nil
+}
+
+func buildWeightTrend(app core.App, userID string, from time.Time) (types.WeightTrend, error) {
+	rows, samples, err := loadWeightSamples(app, userID, from.Add(-trendWarmup))
+	if err != nil {
+		return types.WeightTrend{}, err
+	}
+
+	trend := nutrition.SmoothWeights(samples)
+
+	result := types.WeightTrend{Points: []types.WeightPoint{}}
+	for i, row := range rows {
+		if samples[i].At.Before(from) {
+			continue
+		}
+
+		result.Points = append(result.Points, types.WeightPoint{
+			ID:         row.ID,
+			MeasuredAt: samples[i].At,
+			WeightKg:   row.WeightKg,
+			TrendKg:    math.Round(trend[i]*100) / 100,
+		})
+	}
+
+	if len(samples) == 0 {
+		return result, nil
+	}
+
+	last := len(samples) - 1
+	result.LatestKg = samples[last].WeightKg
+	result.TrendKg = math.Round(trend[last]*100) / 100
+
+	rate := nutrition.WeeklyRate(samples, trend)
+	result.WeeklyRateKg = math.Round(rate*100) / 100
+	result.WeeklyRatePercent = math.Round(rate/trend[last]*10000) / 100
+
+	return result, nil
+}
+
+func HandleGetWeightTrend(e *core.RequestEvent) error {
+	days := defaultTrendDays
+	if raw := e.Request.URL.Query().Get("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxTrendDays {
+			return apis.NewBadRequestError("Invalid days, expected 1 to 730", err)
+		}
+		days = parsed
+	}
+
+	from := time.Now().AddDate(0, 0, -days)
+
+	trend, err := buildWeightTrend(e.App, e.Auth.Id, from)
+	if err != nil {
+		return apis.NewBadRequestError("Could not build weight trend", err)
+	}
+
+	return e.JSON(200, trend)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ignoxx/caloriemate/ai"
+	"github.com/ignoxx/caloriemate/api"
+	"github.com/ignoxx/caloriemate/importer"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// health exports of a few years of watch data are well above the default
+// request body limit
+const maxImportSize = 2 << 30
+
+func registerCommands(app *pocketbase.PocketBase, imgLlm ai.Embedder) {
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import data exported from other apps",
+	}
+
+	importCmd.AddCommand(&cobra.Command{
+		Use:   "health <user> <export.zip>",
+		Short: "Import an Apple Health or Google Takeout Fit export for a user (id or email)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := findUser(app, args[0])
+			if err != nil {
+				return err
+			}
+
+			report, err := importer.ImportHealthArchive(app, user.Id, args[1])
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Imported %s export for %s\n", report.Source, user.Email())
+			printCounts("steps", report.Steps)
+			printCounts("weights", report.Weights)
+			printCounts("workouts", report.Workouts)
+			return nil
+		},
+	})
+
+	var diaryDryRun bool
+
+	diaryCmd := &cobra.Command{
+		Use:   "diary <user> <export.csv>",
+		Short: "Import a MyFitnessPal or Cronometer diary export for a user (id or email)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, err := findUser(app, args[0])
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			report, err := importer.ImportDiary(app, user.Id, f, diaryDryRun)
+			if err != nil {
+				return err
+			}
+
+			if report.DryRun {
+				fmt.Printf("Dry run of %s diary for %s, nothing was saved\n", report.Source, user.Email())
+			} else {
+				fmt.Printf("Imported %s diary for %s\n", report.Source, user.Email())
+			}
+			if report.From != "" {
+				fmt.Printf("  days      %s to %s\n", report.From, report.To)
+			}
+			printCounts("meals", report.Meals)
+			printCounts("entries", report.Entries)
+			return nil
+		},
+	}
+	diaryCmd.Flags().BoolVar(&diaryDryRun, "dry-run", false, "report what would be imported without saving")
+	importCmd.AddCommand(diaryCmd)
+
+	app.RootCmd.AddCommand(importCmd)
+
+	var (
+		exportFrom   string
+		exportTo     string
+		exportFormat string
+		exportOut    string
+	)
+
+	exportCmd := &cobra.Command{
+		Use:   "export <user>",
+		Short: "Export a user's food diary and activities (id or email)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if exportFormat != api.EXPORT_FORMAT_CSV && exportFormat != api.EXPORT_FORMAT_JSON {
+				return errors.New("invalid format, expected csv or json")
+			}
+
+			user, err := findUser(app, args[0])
+			if err != nil {
+				return err
+			}
+
+			fromDay, toDay, err := api.ParseExportRange(exportFrom, exportTo, utils.UserLocation(app, user.Id))
+			if err != nil {
+				return err
+			}
+
+			export, err := api.BuildExport(app, user.Id, fromDay, toDay)
+			if err != nil {
+				return err
+			}
+
+			if exportOut == "" {
+				exportOut = api.ExportFileName(export, exportFormat)
+			}
+
+			f, err := os.Create(exportOut)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			if err := api.WriteExport(f, export, exportFormat); err != nil {
+				return err
+			}
+
+			fmt.Printf("Exported %d meals and %d activities to %s\n", len(export.Meals), len(export.Activities), exportOut)
+			return nil
+		},
+	}
+	exportCmd.Flags().StringVar(&exportFrom, "from", "", "first day to export, YYYY-MM-DD (default: everything)")
+	exportCmd.Flags().StringVar(&exportTo, "to", "", "last day to export, YYYY-MM-DD (default: today)")
+	exportCmd.Flags().StringVar(&exportFormat, "format", api.EXPORT_FORMAT_CSV, "csv (zip with one file per sheet) or json")
+	exportCmd.Flags().StringVarP(&exportOut, "out", "o", "", "output file (default: caloriemate-<from>-<to>.<ext>)")
+
+	app.RootCmd.AddCommand(exportCmd)
+
+	vectorsCmd := &cobra.Command{
+		Use:   "vectors",
+		Short: "Maintain the meal image vector index",
+	}
+
+	var reconcileDryRun bool
+
+	reconcileCmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Remove orphaned vectors and embed meals that are missing one",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := reconcileVectors(app, imgLlm, reconcileDryRun)
+			if err != nil {
+				return err
+			}
+
+			if reconcileDryRun {
+				fmt.Printf("Found %d orphaned vectors and %d meals without a vector, nothing was changed\n", report.Orphaned, report.Missing)
+				return nil
+			}
+
+			fmt.Printf("Removed %d orphaned vectors\n", report.Orphaned)
+			fmt.Printf("Regenerated %d of %d missing vectors", report.Regenerated, report.Missing)
+			if report.Failed > 0 {
+				fmt.Printf(", %d failed (see logs)", report.Failed)
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+	reconcileCmd.Flags().BoolVar(&reconcileDryRun, "dry-run", false, "only report what would be changed")
+	vectorsCmd.AddCommand(reconcileCmd)
+
+	var reindexForce bool
+
+	reindexCmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "Re-embed all meal images with the configured embedder and switch to the new vectors",
+		Long: "Re-embeds every analyzed meal image into a new vector set and switches over once all are done.\n" +
+			"An interrupted reindex resumes where it stopped when run again with the same model.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := reindexVectors(app, imgLlm, reindexForce, func(done, total int) {
+				fmt.Printf("\rEmbedding meal images %d/%d", done, total)
+			})
+			if errors.Is(err, errVectorsUpToDate) {
+				fmt.Printf("Vectors already use %s, use --force to re-embed anyway\n", report.Previous.Model)
+				return nil
+			}
+			if report.Total > 0 {
+				fmt.Println()
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Embedded %d meals with %s (%d dimensions)", report.Embedded, report.Set.Model, report.Set.Dimensions)
+			if report.Resumed > 0 {
+				fmt.Printf(", %d were done before", report.Resumed)
+			}
+			fmt.Println()
+
+			if !report.Switched {
+				fmt.Printf("%d meals failed (see logs), still using %s, run again to retry them\n", report.Failed, report.Previous.Model)
+				return nil
+			}
+
+			fmt.Printf("Switched from %s to %s\n", report.Previous.Model, report.Set.Model)
+			return nil
+		},
+	}
+	reindexCmd.Flags().BoolVar(&reindexForce, "force", false, "re-embed even if the vectors already use the configured model")
+	vectorsCmd.AddCommand(reindexCmd)
+
+	app.RootCmd.AddCommand(vectorsCmd)
+}
+
+// findUser looks a user up by record id or email.
+func findUser(app core.App, idOrEmail string) (*core.Record, error) {
+	if user, err := app.FindRecordById(types.COL_USERS, idOrEmail); err == nil {
+		return user, nil
+	}
+
+	user, err := app.FindAuthRecordByEmail(types.COL_USERS, idOrEmail)
+	if err != nil {
+		return nil, errors.New("no user with id or email " + idOrEmail)
+	}
+
+	return user, nil
+}
+
+func printCounts(name string, c importer.Counts) {
+	fmt.Printf("  %-9s %d created, %d updated, %d skipped\n", name, c.Created, c.Updated, c.Skipped)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ignoxx/caloriemate/api"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultAnalysisCacheWindow  = 24 * time.Hour
+	defaultDuplicateEntryWindow = 2 * time.Minute
+)
+
+// dedupConfig holds how far back a repeated upload reuses an earlier
+// analysis, and how close in time two diary entries of the same meal count
+// as one. A zero window turns the check off.
+type dedupConfig struct {
+	AnalysisWindow time.Duration
+	EntryWindow    time.Duration
+}
+
+func loadDedupConfig() dedupConfig {
+	return dedupConfig{
+		AnalysisWindow: durationFromEnv("ANALYSIS_CACHE_WINDOW", defaultAnalysisCacheWindow),
+		EntryWindow:    durationFromEnv("DUPLICATE_ENTRY_WINDOW", defaultDuplicateEntryWindow),
+	}
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid duration, using default", "env", name, "value", raw, "default", fallback)
+		return fallback
+	}
+
+	return d
+}
+
+func floatFromEnv(name string, fallback float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil || f < 0 {
+		slog.Warn("Invalid number, using default", "env", name, "value", raw, "default", fallback)
+		return fallback
+	}
+
+	return f
+}
+
+// setImageHash hashes a newly uploaded image before the record is saved, and
+// clears the hash when the image was removed.
+func setImageHash(record *core.Record) error {
+	uploads := record.GetUnsavedFiles("image")
+	if len(uploads) == 0 {
+		if len(record.GetStringSlice("image")) == 0 {
+			record.Set("image_hash", "")
+		}
+		return nil
+	}
+
+	f, err := uploads[0].Reader.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+
+	record.Set("image_hash", hex.EncodeToString(hash.Sum(nil)))
+	return nil
+}
+
+// findCachedAnalysis looks for an analyzed meal of the same user with the
+// same photo and description, uploaded within the window.
+func findCachedAnalysis(app core.App, record *core.Record, window time.Duration) *core.Record {
+	hash := record.GetString("image_hash")
+	if window <= 0 || hash == "" {
+		return nil
+	}
+
+	cached, err := app.FindRecordsByFilter(types.COL_MEAL_TEMPLATES,
+		"user = {:user} && image_hash = {:hash} && description = {:description} && processing_status = 'completed' && id != {:id} && created >= {:since}",
+		"-created", 1, 0,
+		dbx.Params{
+			"user":        record.GetString("user"),
+			"hash":        hash,
+			"description": record.GetString("description"),
+			"id":          record.Id,
+			"since":       utils.FormatDBTime(time.Now().Add(-window)),
+		},
+	)
+	if err != nil || len(cached) == 0 {
+		return nil
+	}
+
+	return cached[0]
+}
+
+// reuseCachedAnalysis gives the record the analysis and vectors of an
+// identical earlier upload, so neither the embedder nor the LLM are called.
+func reuseCachedAnalysis(app core.App, record, cached *core.Record) error {
+	if err := copyMealVectors(app, cached, record); err != nil {
+		return err
+	}
+
+	// the same photo is the same meal, so it joins the same group
+	api.ApplyMealMatch(app, record, cached)
+	record.Set("suggested_meal_template_id", "")
+	record.Set("suggested_match_distance", 0)
+
+	if err := app.Save(record); err != nil {
+		slog.Error("Failed to save meal template with cached analysis", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// copyMealVectors copies the vectors of one template to another in every
+// vector set, they show the same image.
+func copyMealVectors(app core.App, from, to *core.Record) error {
+	sets, err := api.FindVectorSets(app)
+	if err != nil {
+		return err
+	}
+
+	for _, set := range sets {
+		_, err := app.DB().NewQuery("INSERT INTO {{" + set.Name + "}}(user_id, meal_template_id, embedding) SELECT user_id, {:to}, embedding FROM {{" + set.Name + "}} WHERE meal_template_id = {:from} AND user_id = {:user}").Bind(dbx.Params{
+			"from": from.Id,
+			"to":   to.Id,
+			"user": to.GetString("user"),
+		}).Execute()
+		if err != nil {
+			slog.Error("Failed to copy meal vector", "recordId", to.Id, "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findDuplicateEntry returns an entry of the same user logged within the
+// window that shows the same meal, either the same template or a template
+// with the identical photo. Imported entries are never duplicates, a diary
+// can hold the same food twice at the same time.
+func findDuplicateEntry(app core.App, record *core.Record, window time.Duration) *core.Record {
+	if window <= 0 || record.GetString("external_id") != "" {
+		return nil
+	}
+
+	mealIDs := []any{record.GetString("meal")}
+
+	if meal, err := app.FindRecordById(types.COL_MEAL_TEMPLATES, record.GetString("meal")); err == nil && meal.GetString("image_hash") != "" {
+		var sameImage []string
+		err := app.DB().Select("id").From(types.COL_MEAL_TEMPLATES).Where(dbx.HashExp{
+			"user":       record.GetString("user"),
+			"image_hash": meal.GetString("image_hash"),
+		}).Column(&sameImage)
+		if err == nil {
+			for _, id := range sameImage {
+				mealIDs = append(mealIDs, id)
+			}
+		}
+	}
+
+	consumedAt := record.GetDateTime("consumed_at").Time()
+
+	duplicates, err := app.FindAllRecords(types.COL_MEAL_HISTORY,
+		dbx.HashExp{"user": record.GetString("user")},
+		dbx.In("meal", mealIDs...),
+		dbx.Not(dbx.HashExp{"id": record.Id}),
+		dbx.NewExp("consumed_at >= {:from} AND consumed_at <= {:to}", dbx.Params{
+			"from": utils.FormatDBTime(consumedAt.Add(-window)),
+			"to":   utils.FormatDBTime(consumedAt.Add(window)),
+		}),
+	)
+	if err != nil || len(duplicates) == 0 {
+		return nil
+	}
+
+	return duplicates[0]
+}
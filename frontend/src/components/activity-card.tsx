@@ -1,14 +1,18 @@
 import { Card, CardContent } from "./ui/card";
 import { Badge } from "./ui/badge";
 import { Clock, Footprints } from "lucide-react";
-import type { ActivityLogsResponse } from "../types/pocketbase-types";
+import {
+  ActivityLogsActivityTypeOptions,
+  type ActivityLogsResponse,
+} from "../types/pocketbase-types";
+import { activityLabel } from "../lib/activities";
 
 interface ActivityCardProps {
   activity: ActivityLogsResponse;
 }
 
 export function ActivityCard({ activity }: ActivityCardProps) {
-  const timeString = new Date(activity.created).toLocaleTimeString("en-US", {
+  const timeString = new Date(activity.started_at || activity.created).toLocaleTimeString("en-US", {
     hour: "numeric",
     minute: "2-digit",
     hour12: true,
@@ -25,7 +29,9 @@ export function ActivityCard({ activity }: ActivityCardProps) {
           <div className="flex-1 min-w-0">
             <div className="flex justify-between items-start mb-2">
               <h3 className="font-medium text-sm text-foreground">
-                Walking
+                {activity.activity_type === ActivityLogsActivityTypeOptions.custom && activity.custom_name
+                  ? activity.custom_name
+                  : activityLabel(activity.activity_type)}
               </h3>
             </div>
 
@@ -38,6 +44,11 @@ export function ActivityCard({ activity }: ActivityCardProps) {
                   {activity.steps.toLocaleString()} steps
                 </Badge>
               )}
+              {activity.distance_km > 0 && (
+                <Badge variant="outline" className="text-xs border-green-300 text-green-700 dark:border-green-700 dark:text-green-400">
+                  {activity.distance_km.toFixed(1)} km
+                </Badge>
+              )}
               {activity.duration_minutes > 0 && (
                 <Badge variant="outline" className="text-xs border-green-300 text-green-700 dark:border-green-700 dark:text-green-400">
                   {activity.duration_minutes} min
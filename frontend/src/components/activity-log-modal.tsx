@@ -1,4 +1,4 @@
-import { useState } from "react";
+import { useRef, useState, type ChangeEvent } from "react";
 import { Button } from "./ui/button";
 import { Input } from "./ui/input";
 import { Label } from "./ui/label";
@@ -9,47 +9,87 @@ import {
   DrawerTitle,
   DrawerFooter,
 } from "./ui/drawer";
+import {
+  Select,
+  SelectContent,
+  SelectItem,
+  SelectTrigger,
+  SelectValue,
+} from "./ui/select";
 import { Footprints } from "lucide-react";
-import { calculateCaloriesBurnedFromSteps, calculateCaloriesBurnedFromDuration } from "../lib/calories";
+import { ActivityLogsActivityTypeOptions } from "../types/pocketbase-types";
+import { activityLabel } from "../lib/activities";
+
+export interface ActivityLogData {
+  activityType: ActivityLogsActivityTypeOptions;
+  customName?: string;
+  met?: number;
+  steps?: number;
+  durationMinutes?: number;
+}
 
 interface ActivityLogModalProps {
   open: boolean;
   onClose: () => void;
-  onSubmit: (data: { steps?: number; durationMinutes?: number; caloriesBurned: number }) => void;
-  userWeightKg: number;
+  onSubmit: (data: ActivityLogData) => void;
+  onImport: (file: File) => void;
 }
 
-export function ActivityLogModal({ open, onClose, onSubmit, userWeightKg }: ActivityLogModalProps) {
+// activities that can be logged by step count, the rest by duration only
+const STEP_ACTIVITIES: ActivityLogsActivityTypeOptions[] = [
+  ActivityLogsActivityTypeOptions.walking,
+  ActivityLogsActivityTypeOptions.running,
+  ActivityLogsActivityTypeOptions.hiking,
+];
+
+export function ActivityLogModal({ open, onClose, onSubmit, onImport }: ActivityLogModalProps) {
+  const importInputRef = useRef<HTMLInputElement>(null);
+  const [activityType, setActivityType] = useState<ActivityLogsActivityTypeOptions>(
+    ActivityLogsActivityTypeOptions.walking,
+  );
   const [inputMode, setInputMode] = useState<"steps" | "duration">("steps");
   const [steps, setSteps] = useState("");
   const [durationMinutes, setDurationMinutes] = useState("");
+  const [customName, setCustomName] = useState("");
+  const [met, setMet] = useState("");
+
+  const supportsSteps = STEP_ACTIVITIES.includes(activityType);
+  const isCustom = activityType === ActivityLogsActivityTypeOptions.custom;
+  const mode = supportsSteps ? inputMode : "duration";
 
+  // calories burned are computed by the server from the user's current weight
   const handleSubmit = () => {
-    if (inputMode === "steps" && steps) {
-      const stepsNum = parseInt(steps);
-      const calories = calculateCaloriesBurnedFromSteps(stepsNum, userWeightKg);
-      onSubmit({ steps: stepsNum, caloriesBurned: calories });
-    } else if (inputMode === "duration" && durationMinutes) {
-      const duration = parseInt(durationMinutes);
-      const calories = calculateCaloriesBurnedFromDuration(duration, userWeightKg);
-      onSubmit({ durationMinutes: duration, caloriesBurned: calories });
+    const data: ActivityLogData = { activityType };
+    if (isCustom) {
+      data.customName = customName;
+      data.met = parseFloat(met);
+    }
+
+    if (mode === "steps" && steps) {
+      onSubmit({ ...data, steps: parseInt(steps) });
+    } else if (mode === "duration" && durationMinutes) {
+      onSubmit({ ...data, durationMinutes: parseInt(durationMinutes) });
     }
     setSteps("");
     setDurationMinutes("");
+    setCustomName("");
+    setMet("");
     onClose();
   };
 
-  const canSubmit = (inputMode === "steps" && steps) || (inputMode === "duration" && durationMinutes);
+  const handleImport = (e: ChangeEvent<HTMLInputElement>) => {
+    const file = e.target.files?.[0];
+    e.target.value = "";
+    if (!file) return;
 
-  const estimatedCalories = () => {
-    if (inputMode === "steps" && steps) {
-      return calculateCaloriesBurnedFromSteps(parseInt(steps), userWeightKg);
-    } else if (inputMode === "duration" && durationMinutes) {
-      return calculateCaloriesBurnedFromDuration(parseInt(durationMinutes), userWeightKg);
-    }
-    return 0;
+    onImport(file);
+    onClose();
   };
 
+  const canSubmit =
+    ((mode === "steps" && steps) || (mode === "duration" && durationMinutes)) &&
+    (!isCustom || parseFloat(met) > 0);
+
   return (
     <Drawer open={open} onOpenChange={(isOpen) => !isOpen && onClose()}>
       <DrawerContent className="!fixed !bottom-0 !max-h-[min(500px,90vh)]">
@@ -57,29 +97,75 @@ export function ActivityLogModal({ open, onClose, onSubmit, userWeightKg }: Acti
           <DrawerHeader className="flex-shrink-0">
             <DrawerTitle className="flex items-center gap-2">
               <Footprints className="h-5 w-5 text-green-600" />
-              Log Walking Activity
+              Log Activity
             </DrawerTitle>
           </DrawerHeader>
 
           <div className="px-4 pb-4 space-y-4 overflow-y-auto flex-1 overscroll-contain touch-pan-y" style={{WebkitOverflowScrolling: 'touch'}}>
-            <div className="flex gap-2">
-              <Button
-                variant={inputMode === "steps" ? "default" : "outline"}
-                onClick={() => setInputMode("steps")}
-                className="flex-1"
+            <div className="space-y-2">
+              <Label htmlFor="activity-type">Activity</Label>
+              <Select
+                value={activityType}
+                onValueChange={(value) => setActivityType(value as ActivityLogsActivityTypeOptions)}
               >
-                Steps
-              </Button>
-              <Button
-                variant={inputMode === "duration" ? "default" : "outline"}
-                onClick={() => setInputMode("duration")}
-                className="flex-1"
-              >
-                Duration
-              </Button>
+                <SelectTrigger id="activity-type">
+                  <SelectValue placeholder="Select activity" />
+                </SelectTrigger>
+                <SelectContent>
+                  {Object.values(ActivityLogsActivityTypeOptions).map((type) => (
+                    <SelectItem key={type} value={type}>
+                      {activityLabel(type)}
+                    </SelectItem>
+                  ))}
+                </SelectContent>
+              </Select>
             </div>
 
-            {inputMode === "steps" ? (
+            {isCustom && (
+              <div className="flex gap-2">
+                <div className="space-y-2 flex-1">
+                  <Label htmlFor="custom-name">Name</Label>
+                  <Input
+                    id="custom-name"
+                    placeholder="e.g., Rowing"
+                    value={customName}
+                    onChange={(e) => setCustomName(e.target.value)}
+                  />
+                </div>
+                <div className="space-y-2 w-24">
+                  <Label htmlFor="met">MET</Label>
+                  <Input
+                    id="met"
+                    type="number"
+                    inputMode="decimal"
+                    placeholder="e.g., 6"
+                    value={met}
+                    onChange={(e) => setMet(e.target.value)}
+                  />
+                </div>
+              </div>
+            )}
+
+            {supportsSteps && (
+              <div className="flex gap-2">
+                <Button
+                  variant={inputMode === "steps" ? "default" : "outline"}
+                  onClick={() => setInputMode("steps")}
+                  className="flex-1"
+                >
+                  Steps
+                </Button>
+                <Button
+                  variant={inputMode === "duration" ? "default" : "outline"}
+                  onClick={() => setInputMode("duration")}
+                  className="flex-1"
+                >
+                  Duration
+                </Button>
+              </div>
+            )}
+
+            {mode === "steps" ? (
               <div className="space-y-2">
                 <Label htmlFor="steps">Steps</Label>
                 <Input
@@ -107,18 +193,13 @@ export function ActivityLogModal({ open, onClose, onSubmit, userWeightKg }: Acti
               </div>
             )}
 
-            <div className="rounded-lg p-3 text-center transition-all duration-200 min-h-[88px] flex flex-col justify-center">
-              {canSubmit ? (
-                <div className="bg-green-50 border border-green-200 rounded-lg p-3 -m-3">
-                  <p className="text-sm text-green-700">Estimated calories burned</p>
-                  <p className="text-2xl font-bold text-green-800">{estimatedCalories()} kcal</p>
-                </div>
-              ) : (
-                <div className="bg-gray-50 border border-gray-200 rounded-lg p-3 -m-3">
-                  <p className="text-sm text-gray-600">💡 Quick tip</p>
-                  <p className="text-base text-gray-700">~2000 steps ≈ 1km walked</p>
-                </div>
-              )}
+            <div className="bg-gray-50 border border-gray-200 rounded-lg p-3 text-center">
+              <p className="text-sm text-gray-600">💡 Quick tip</p>
+              <p className="text-base text-gray-700">
+                {mode === "steps"
+                  ? "~2000 steps ≈ 1km walked"
+                  : "Calories burned are calculated from your current weight"}
+              </p>
             </div>
           </div>
 
@@ -126,6 +207,20 @@ export function ActivityLogModal({ open, onClose, onSubmit, userWeightKg }: Acti
             <Button onClick={handleSubmit} disabled={!canSubmit} className="w-full">
               Log Activity
             </Button>
+            <input
+              ref={importInputRef}
+              type="file"
+              accept=".gpx,.tcx,.fit"
+              className="hidden"
+              onChange={handleImport}
+            />
+            <Button
+              variant="outline"
+              onClick={() => importInputRef.current?.click()}
+              className="w-full"
+            >
+              Import from watch (GPX, TCX, FIT)
+            </Button>
           </DrawerFooter>
         </div>
       </DrawerContent>
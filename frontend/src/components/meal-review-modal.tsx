@@ -21,7 +21,7 @@ import {
 import { X, CheckCircle, Plus, Repeat, Trash2, Link as LinkIcon, Loader2, ChevronDown, ChevronUp, Minus } from "lucide-react";
 import { MealEntry, SimilarMeal } from "../types/meal";
 import { Collections, MealTemplatesProcessingStatusOptions } from "../types/pocketbase-types";
-import { fetchSimilarMeals } from "../lib/pocketbase";
+import { fetchSimilarMeals, resolveMealSuggestion } from "../lib/pocketbase";
 import pb from "../lib/pocketbase";
 
 interface MealReviewModalProps {
@@ -68,6 +68,38 @@ export function MealReviewModal({
   const [isUpdating, setIsUpdating] = useState(false);
   const [isDescriptionExpanded, setIsDescriptionExpanded] = useState(false);
   const [initialPortionMultiplier] = useState(meal.portionMultiplier || 1);
+  const [suggestedMeal, setSuggestedMeal] = useState<{ name: string; total_calories: number } | null>(null);
+  const [isResolvingSuggestion, setIsResolvingSuggestion] = useState(false);
+
+  useEffect(() => {
+    if (!meal.suggestedMealTemplateId) {
+      setSuggestedMeal(null);
+      return;
+    }
+
+    pb.collection("meal_templates")
+      .getOne(meal.suggestedMealTemplateId)
+      .then((template) =>
+        setSuggestedMeal({ name: template.name || "", total_calories: template.total_calories || 0 }),
+      )
+      .catch(() => setSuggestedMeal(null));
+  }, [meal.suggestedMealTemplateId]);
+
+  const handleResolveSuggestion = async (action: "confirm" | "reject") => {
+    if (!meal.mealTemplateId) return;
+
+    setIsResolvingSuggestion(true);
+    try {
+      await resolveMealSuggestion(meal.mealTemplateId, action);
+      setSuggestedMeal(null);
+      onMealUpdated?.(meal);
+      if (action === "confirm") onClose();
+    } catch (error) {
+      console.error("Failed to resolve suggested match:", error);
+    } finally {
+      setIsResolvingSuggestion(false);
+    }
+  };
 
   const getFullImageUrl = () => {
     if (!meal.imageUrl) return "/placeholder.svg";
@@ -89,8 +121,8 @@ export function MealReviewModal({
       try {
         // For existing meals, use mealTemplateId if available, otherwise use id
         const templateId = meal.mealTemplateId || meal.id;
-        let similar = await fetchSimilarMeals(templateId);
-        similar = similar.filter((meal) => Math.round((1 - meal.distance) * 100) >= 70)
+        // at least 70% similar
+        const similar = await fetchSimilarMeals(templateId, 0.3);
         setSimilarMeals(similar);
         console.log("SET SIMILAR:", similar)
       } catch (error) {
@@ -321,6 +353,38 @@ export function MealReviewModal({
             />
           </div>
 
+          {/* Suggested match from an earlier meal */}
+          {suggestedMeal && (
+            <Card className="border-primary/40">
+              <CardContent className="p-3 space-y-2">
+                <p className="text-sm">
+                  This looks like <span className="font-medium">{suggestedMeal.name}</span> ({suggestedMeal.total_calories} kcal)
+                  you had before. Use its nutrition instead of this analysis?
+                </p>
+                <div className="flex gap-2">
+                  <Button
+                    size="sm"
+                    className="flex-1"
+                    disabled={isResolvingSuggestion}
+                    onClick={() => handleResolveSuggestion("confirm")}
+                  >
+                    <LinkIcon className="h-4 w-4 mr-1" />
+                    Use it
+                  </Button>
+                  <Button
+                    size="sm"
+                    variant="outline"
+                    className="flex-1"
+                    disabled={isResolvingSuggestion}
+                    onClick={() => handleResolveSuggestion("reject")}
+                  >
+                    Keep analysis
+                  </Button>
+                </div>
+              </CardContent>
+            </Card>
+          )}
+
           {/* AI Analysis Results */}
           <div className="space-y-3">
             <div className="flex items-center justify-between">
@@ -1,4 +1,4 @@
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { Button } from "./ui/button";
 import { Input } from "./ui/input";
 import { Label } from "./ui/label";
@@ -16,8 +16,14 @@ import {
   SelectValue,
 } from "./ui/select";
 import { User, Target, Calculator } from "lucide-react";
-import { OnboardingData, OnboardingFormData } from "../types/common";
+import {
+  NutritionTargets,
+  OnboardingData,
+  OnboardingFormData,
+} from "../types/common";
+import { previewTargets } from "../lib/pocketbase";
 import { 
+  UserProfilesBmrFormulaOptions,
   UserProfilesGenderOptions, 
   UserProfilesActivityLevelOptions, 
   UserProfilesGoalOptions 
@@ -37,70 +43,50 @@ export function OnboardingModal({ open, onComplete }: OnboardingModalProps) {
     gender: UserProfilesGenderOptions.male,
     activity: UserProfilesActivityLevelOptions.sedentary,
     goal: UserProfilesGoalOptions.lose_weight,
+    bmrFormula: UserProfilesBmrFormulaOptions.mifflin_st_jeor,
+    bodyFatPercent: "",
     customProtein: "",
     customCalories: "",
   });
+  const [targets, setTargets] = useState<NutritionTargets | null>(null);
 
   const handleInputChange = (field: string, value: string) => {
     setFormData((prev) => ({ ...prev, [field]: value }));
   };
 
-  const calculateGoals = () => {
-    const age = Number.parseInt(formData.age);
-    const weight = Number.parseInt(formData.weight);
-    const height = Number.parseInt(formData.height);
-
-    // Simple BMR calculation (Mifflin-St Jeor for male, approximate)
-    const bmr = 10 * weight + 6.25 * height - 5 * age + 5;
-
-    // Activity multiplier
-    const activityMultipliers = {
-      sedentary: 1.2,
-      light: 1.375,
-      moderate: 1.55,
-      active: 1.725,
-      "very active": 1.9,
-    };
-
-    const tdee =
-      bmr *
-      activityMultipliers[
-        formData.activity as keyof typeof activityMultipliers
-      ];
+  const buildOnboardingData = (): OnboardingData => ({
+    age: parseInt(formData.age),
+    weight: parseInt(formData.weight),
+    height: parseInt(formData.height),
+    gender: formData.gender,
+    activityLevel: formData.activity,
+    goal: formData.goal,
+    bmrFormula: formData.bmrFormula,
+    bodyFatPercent: formData.bodyFatPercent
+      ? parseFloat(formData.bodyFatPercent)
+      : undefined,
+    customCalories: formData.customCalories
+      ? parseInt(formData.customCalories)
+      : undefined,
+    customProtein: formData.customProtein
+      ? parseInt(formData.customProtein)
+      : undefined,
+  });
 
-    // Goal adjustment
-    let calories = tdee;
-    if (formData.goal === "lose_weight") calories -= 500;
-    if (formData.goal === "gain_weight") calories += 500;
+  // the targets come from the server so they match what the profile gets
+  useEffect(() => {
+    if (step !== 3) return;
 
-    // Protein: 1.6-2.2g per kg body weight
-    const protein = Math.round(weight * 1.8);
-
-    return {
-      calories: Math.round(calories),
-      protein,
-      weight,
-      age,
-    };
-  };
+    previewTargets(buildOnboardingData())
+      .then(setTargets)
+      .catch((error) => {
+        console.error("Failed to calculate targets:", error);
+        setTargets(null);
+      });
+  }, [step]);
 
   const handleComplete = () => {
-    const onboardingData: OnboardingData = {
-      age: parseInt(formData.age),
-      weight: parseInt(formData.weight),
-      height: parseInt(formData.height),
-      gender: formData.gender,
-      activityLevel: formData.activity,
-      goal: formData.goal,
-      customCalories: formData.customCalories
-        ? parseInt(formData.customCalories)
-        : undefined,
-      customProtein: formData.customProtein
-        ? parseInt(formData.customProtein)
-        : undefined,
-    };
-
-    onComplete(onboardingData);
+    onComplete(buildOnboardingData());
   };
 
   return (
@@ -161,7 +147,34 @@ export function OnboardingModal({ open, onComplete }: OnboardingModalProps) {
                   <SelectContent>
                     <SelectItem value="male">Male</SelectItem>
                     <SelectItem value="female">Female</SelectItem>
-                    <SelectItem value="other">Other</SelectItem>
+                    <SelectItem value="neutral">Other / prefer not to say</SelectItem>
+                  </SelectContent>
+                </Select>
+              </div>
+              <div className="space-y-2">
+                <Label htmlFor="bodyFat">Body fat % (optional)</Label>
+                <Input
+                  id="bodyFat"
+                  type="number"
+                  inputMode="decimal"
+                  placeholder="20"
+                  value={formData.bodyFatPercent}
+                  onChange={(e) => handleInputChange("bodyFatPercent", e.target.value)}
+                />
+              </div>
+              <div className="space-y-2">
+                <Label>BMR formula</Label>
+                <Select
+                  value={formData.bmrFormula}
+                  onValueChange={(value) => handleInputChange("bmrFormula", value)}
+                >
+                  <SelectTrigger>
+                    <SelectValue placeholder="Select formula" />
+                  </SelectTrigger>
+                  <SelectContent>
+                    <SelectItem value="mifflin_st_jeor">Mifflin-St Jeor (recommended)</SelectItem>
+                    <SelectItem value="katch_mcardle">Katch-McArdle (needs body fat %)</SelectItem>
+                    <SelectItem value="harris_benedict">Harris-Benedict</SelectItem>
                   </SelectContent>
                 </Select>
               </div>
@@ -235,10 +248,10 @@ export function OnboardingModal({ open, onComplete }: OnboardingModalProps) {
                   Calculated Targets
                 </h3>
                 <p className="text-sm text-primary">
-                  Calories: {calculateGoals().calories} kcal/day
+                  Calories: {targets ? targets.calories : "…"} kcal/day
                 </p>
                 <p className="text-sm text-primary">
-                  Protein: {calculateGoals().protein}g/day
+                  Protein: {targets ? targets.protein_g : "…"}g/day
                 </p>
               </div>
 
@@ -255,7 +268,7 @@ export function OnboardingModal({ open, onComplete }: OnboardingModalProps) {
                   <Input
                     id="customCalories"
                     type="number"
-                    placeholder={calculateGoals().calories.toString()}
+                    placeholder={targets ? String(targets.calories) : ""}
                     value={formData.customCalories}
                     onChange={(e) =>
                       handleInputChange("customCalories", e.target.value)
@@ -267,7 +280,7 @@ export function OnboardingModal({ open, onComplete }: OnboardingModalProps) {
                   <Input
                     id="customProtein"
                     type="number"
-                    placeholder={calculateGoals().protein.toString()}
+                    placeholder={targets ? String(targets.protein_g) : ""}
                     value={formData.customProtein}
                     onChange={(e) =>
                       handleInputChange("customProtein", e.target.value)
@@ -1,5 +1,5 @@
 import React, { createContext, useContext, useEffect, useState } from 'react'
-import pb, { type User } from '../lib/pocketbase'
+import pb, { createUserProfile, type User } from '../lib/pocketbase'
 import { SignupData } from '../types/common'
 import { Collections } from '@/types/pocketbase-types'
 
@@ -70,20 +70,10 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     const authData = await pb.collection('users').authWithPassword(data.email, data.password)
     setUser(authData.record as unknown as User)
 
-    // Create user profile with goals if provided
-    if (data.onboardingData && data.userGoals) {
+    // Create user profile, the server computes the targets
+    if (data.onboardingData) {
       try {
-        await pb.collection(Collections.UserProfiles).create({
-          user: authData.record.id,
-          target_calories: data.userGoals.target_calories,
-          target_protein_g: data.userGoals.target_protein_g,
-          weight_kg: data.onboardingData.weight,
-          age: data.onboardingData.age,
-          height_cm: data.onboardingData.height,
-          gender: data.onboardingData.gender,
-          activity_level: data.onboardingData.activityLevel,
-          goal: data.onboardingData.goal,
-        })
+        await createUserProfile(authData.record.id, data.onboardingData)
       } catch (error) {
         console.error('Failed to create user profile:', error)
         throw error
@@ -0,0 +1,15 @@
+import { ActivityLogsActivityTypeOptions } from "../types/pocketbase-types";
+
+const LABELS: Record<ActivityLogsActivityTypeOptions, string> = {
+  [ActivityLogsActivityTypeOptions.walking]: "Walking",
+  [ActivityLogsActivityTypeOptions.running]: "Running",
+  [ActivityLogsActivityTypeOptions.cycling]: "Cycling",
+  [ActivityLogsActivityTypeOptions.swimming]: "Swimming",
+  [ActivityLogsActivityTypeOptions.strength_training]: "Strength training",
+  [ActivityLogsActivityTypeOptions.hiking]: "Hiking",
+  [ActivityLogsActivityTypeOptions.custom]: "Custom",
+};
+
+export function activityLabel(type: ActivityLogsActivityTypeOptions): string {
+  return LABELS[type] ?? type;
+}
@@ -1,6 +1,7 @@
 import PocketBase from "pocketbase";
-import { SimilarMeal } from "../types/meal";
-import { TypedPocketBase, UsersResponse } from "../types/pocketbase-types";
+import { MealSearchHit, MealSearchPage, SimilarMeal, SimilarMealsPage } from "../types/meal";
+import { TypedPocketBase, UsersResponse, Collections } from "../types/pocketbase-types";
+import { NutritionTargets, OnboardingData, UserProfile } from "../types/common";
 
 const pb = new PocketBase(
   import.meta.env.VITE_POCKETBASE_URL || "/",
@@ -8,9 +9,13 @@ const pb = new PocketBase(
 
 export const fetchSimilarMeals = async (
   mealId: string,
+  maxDistance?: number,
 ): Promise<SimilarMeal[]> => {
+  const params = new URLSearchParams();
+  if (maxDistance) params.set("max_distance", String(maxDistance));
+
   try {
-    const response = await fetch(`${pb.baseURL}/api/v1/similar/${mealId}`, {
+    const response = await fetch(`${pb.baseURL}/api/v1/similar/${mealId}?${params}`, {
       headers: {
         Authorization: pb.authStore.token ? `Bearer ${pb.authStore.token}` : "",
       },
@@ -20,12 +25,263 @@ export const fetchSimilarMeals = async (
       throw new Error("Failed to fetch similar meals");
     }
 
-    return await response.json();
+    const page: SimilarMealsPage = await response.json();
+    return page.items;
   } catch (error) {
     console.error("Error fetching similar meals:", error);
     return [];
   }
 };
 
+export const searchMeals = async (
+  query: string,
+  limit = 20,
+): Promise<MealSearchHit[]> => {
+  const params = new URLSearchParams({ q: query, limit: String(limit) });
+
+  const response = await fetch(`${pb.baseURL}/api/v1/search?${params}`, {
+    headers: {
+      Authorization: pb.authStore.token ? `Bearer ${pb.authStore.token}` : "",
+    },
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to search meals");
+  }
+
+  const page: MealSearchPage = await response.json();
+  return page.items;
+};
+
+export const resolveMealSuggestion = async (
+  mealTemplateId: string,
+  action: "confirm" | "reject",
+): Promise<void> => {
+  const response = await fetch(
+    `${pb.baseURL}/api/v1/meal/${mealTemplateId}/suggestion/${action}`,
+    {
+      method: "POST",
+      headers: {
+        Authorization: pb.authStore.token ? `Bearer ${pb.authStore.token}` : "",
+      },
+    },
+  );
+
+  if (!response.ok) {
+    throw new Error(`Failed to ${action} suggested match`);
+  }
+};
+
+export const importWorkoutFile = async (file: File): Promise<void> => {
+  const body = new FormData();
+  body.append("file", file);
+
+  const response = await fetch(`${pb.baseURL}/api/v1/activity/import`, {
+    method: "POST",
+    headers: {
+      Authorization: pb.authStore.token ? `Bearer ${pb.authStore.token}` : "",
+    },
+    body,
+  });
+
+  if (!response.ok) {
+    const error = await response.json().catch(() => null);
+    throw new Error(error?.message || "Failed to import workout");
+  }
+};
+
+export interface ImportCounts {
+  created: number;
+  updated: number;
+  skipped: number;
+}
+
+export interface HealthImportReport {
+  source: string;
+  steps: ImportCounts;
+  weights: ImportCounts;
+  workouts: ImportCounts;
+}
+
+export const importHealthExport = async (
+  file: File,
+): Promise<HealthImportReport> => {
+  const body = new FormData();
+  body.append("file", file);
+
+  const response = await fetch(`${pb.baseURL}/api/v1/import/health`, {
+    method: "POST",
+    headers: {
+      Authorization: pb.authStore.token ? `Bearer ${pb.authStore.token}` : "",
+    },
+    body,
+  });
+
+  if (!response.ok) {
+    const error = await response.json().catch(() => null);
+    throw new Error(error?.message || "Failed to import export");
+  }
+
+  return await response.json();
+};
+
+export interface DiaryImportReport {
+  source: string;
+  dry_run: boolean;
+  from?: string;
+  to?: string;
+  meals: ImportCounts;
+  entries: ImportCounts;
+}
+
+export const importDiaryExport = async (
+  file: File,
+  dryRun: boolean,
+): Promise<DiaryImportReport> => {
+  const body = new FormData();
+  body.append("file", file);
+
+  const response = await fetch(
+    `${pb.baseURL}/api/v1/import/diary?dry_run=${dryRun}`,
+    {
+      method: "POST",
+      headers: {
+        Authorization: pb.authStore.token ? `Bearer ${pb.authStore.token}` : "",
+      },
+      body,
+    },
+  );
+
+  if (!response.ok) {
+    const error = await response.json().catch(() => null);
+    throw new Error(error?.message || "Failed to import diary");
+  }
+
+  return await response.json();
+};
+
+export const downloadDiaryExport = async (
+  format: "csv" | "json",
+): Promise<void> => {
+  const response = await fetch(`${pb.baseURL}/api/v1/export?format=${format}`, {
+    headers: {
+      Authorization: pb.authStore.token ? `Bearer ${pb.authStore.token}` : "",
+    },
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to export diary");
+  }
+
+  const disposition = response.headers.get("Content-Disposition") || "";
+  const fileName =
+    disposition.match(/filename="(.+)"/)?.[1] ||
+    `caloriemate.${format === "json" ? "json" : "zip"}`;
+
+  const url = URL.createObjectURL(await response.blob());
+  const link = document.createElement("a");
+  link.href = url;
+  link.download = fileName;
+  link.click();
+  URL.revokeObjectURL(url);
+};
+
+export const downloadAccountExport = async (): Promise<void> => {
+  const response = await fetch(`${pb.baseURL}/api/v1/account/export`, {
+    headers: {
+      Authorization: pb.authStore.token ? `Bearer ${pb.authStore.token}` : "",
+    },
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to export account");
+  }
+
+  const url = URL.createObjectURL(await response.blob());
+  const link = document.createElement("a");
+  link.href = url;
+  link.download = "caloriemate-account.zip";
+  link.click();
+  URL.revokeObjectURL(url);
+};
+
+export interface AccountDeletionReport {
+  user_id: string;
+  deleted: Record<string, number>;
+  remaining: Record<string, number>;
+  verified: boolean;
+}
+
+export const deleteAccount = async (): Promise<AccountDeletionReport> => {
+  const response = await fetch(`${pb.baseURL}/api/v1/account`, {
+    method: "DELETE",
+    headers: {
+      Authorization: pb.authStore.token ? `Bearer ${pb.authStore.token}` : "",
+    },
+  });
+
+  if (!response.ok) {
+    const error = await response.json().catch(() => null);
+    throw new Error(error?.message || "Failed to delete account");
+  }
+
+  return await response.json();
+};
+
+const profileFields = (data: OnboardingData) => ({
+  age: data.age,
+  weight_kg: data.weight,
+  height_cm: data.height,
+  gender: data.gender,
+  activity_level: data.activityLevel,
+  goal: data.goal,
+  bmr_formula: data.bmrFormula,
+  body_fat_percent: data.bodyFatPercent || 0,
+});
+
+// previewTargets asks the server for the targets these onboarding answers
+// would produce, the profile hooks use the same formulas when saving.
+export const previewTargets = async (
+  data: OnboardingData,
+): Promise<NutritionTargets> => {
+  const response = await fetch(`${pb.baseURL}/api/v1/targets/preview`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      Authorization: pb.authStore.token ? `Bearer ${pb.authStore.token}` : "",
+    },
+    body: JSON.stringify(profileFields(data)),
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to calculate targets");
+  }
+
+  return await response.json();
+};
+
+// createUserProfile stores the onboarding answers. Without custom values the
+// server computes the targets, custom ones are kept as entered.
+export const createUserProfile = async (
+  userId: string,
+  data: OnboardingData,
+): Promise<UserProfile> => {
+  const custom = Boolean(data.customCalories || data.customProtein);
+  const targets = custom ? await previewTargets(data) : null;
+
+  return await pb.collection(Collections.UserProfiles).create({
+    user: userId,
+    ...profileFields(data),
+    ...(targets && {
+      target_calories: data.customCalories || targets.calories,
+      target_protein_g: data.customProtein || targets.protein_g,
+      target_carbs_g: targets.carbs_g,
+      target_fat_g: targets.fat_g,
+    }),
+    custom_targets: custom,
+    timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
+  });
+};
+
 export default pb
 export type User = UsersResponse;
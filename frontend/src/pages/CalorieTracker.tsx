@@ -27,7 +27,7 @@ import { Label } from "../components/ui/label";
 import { OnboardingModal } from "../components/onboarding-modal";
 import { MealReviewModal } from "../components/meal-review-modal";
 import { MealHistoryCard } from "../components/meal-history-card";
-import { ActivityLogModal } from "../components/activity-log-modal";
+import { ActivityLogModal, type ActivityLogData } from "../components/activity-log-modal";
 import { ActivityCard } from "../components/activity-card";
 import { useAuth } from "../contexts/AuthContext";
 import ProfilePage from "./ProfilePage";
@@ -37,7 +37,7 @@ import { UserGoals, OnboardingData, ActivityLog } from "../types/common";
 import { MealEntry, SimilarMeal } from "../types/meal";
 import { Collections, MealTemplatesProcessingStatusOptions } from "../types/pocketbase-types";
 
-import pb from "../lib/pocketbase";
+import pb, { createUserProfile, importWorkoutFile } from "../lib/pocketbase";
 
 export default function CalorieTracker() {
   const [isOnboarded, setIsOnboarded] = useState(false);
@@ -93,6 +93,18 @@ export default function CalorieTracker() {
           weight: profile.weight_kg || 70, // Convert weight_kg to weight
           age: profile.age || 25,
         };
+
+        // today's targets differ from the profile ones when a target schedule is set
+        try {
+          const summary = await pb.send("/api/v1/summary/day", {});
+          if (summary?.targets?.calories > 0) {
+            goals.target_calories = summary.targets.calories;
+            goals.target_protein_g = summary.targets.protein_g;
+          }
+        } catch (error) {
+          console.error("Failed to load today's targets:", error);
+        }
+
         setUserGoals(goals);
         setIsOnboarded(true);
         console.log("User is onboarded, setting goals:", goals);
@@ -113,10 +125,10 @@ export default function CalorieTracker() {
   const loadMealHistory = useCallback(async () => {
     try {
       const records = await pb.collection("meal_history").getList(1, 20, {
-        sort: "-created",
+        sort: "-consumed_at",
         expand: "meal",
         filter: pb.filter(
-          "adjustments != {:adjustment} && created > {:today}",
+          "adjustments != {:adjustment} && consumed_at > {:today}",
           {
             today: new Date(new Date().setHours(0, 0, 0, 0)).toISOString(),
             adjustment: "hidden",
@@ -173,12 +185,14 @@ export default function CalorieTracker() {
             : undefined,
           processingStatus: ((mealTemplate?.processing_status as string) ||
             "pending") as MealTemplatesProcessingStatusOptions,
-          created: record.created,
+          created: (recordData.consumed_at as string) || record.created,
           updated: record.updated,
           linkedMealTemplateId:
             (mealTemplate?.linked_meal_template_id as string) || undefined,
           isPrimaryInGroup:
             (mealTemplate?.is_primary_in_group as boolean) || false,
+          suggestedMealTemplateId:
+            (mealTemplate?.suggested_meal_template_id as string) || undefined,
           portionMultiplier,
           calorieAdjustment: (recordData.calorie_adjustment as number) || 0,
           proteinAdjustment: (recordData.protein_adjustment as number) || 0,
@@ -257,8 +271,8 @@ export default function CalorieTracker() {
   const loadActivityLogs = useCallback(async () => {
     try {
       const records = await pb.collection(Collections.ActivityLogs).getList(1, 20, {
-        sort: "-created",
-        filter: pb.filter("created > {:today}", {
+        sort: "-started_at",
+        filter: pb.filter("started_at > {:today}", {
           today: new Date(new Date().setHours(0, 0, 0, 0)).toISOString(),
         }),
       });
@@ -297,77 +311,17 @@ export default function CalorieTracker() {
 
       console.log("Completing onboarding with data:", data);
 
-      // Calculate default values using the same logic as onboarding components
-      const calculateGoals = () => {
-        const age = data.age;
-        const weight = data.weight;
-        const height = data.height;
-
-        // Simple BMR calculation (Mifflin-St Jeor)
-        let bmr: number;
-        if (data.gender === "male") {
-          bmr = 10 * weight + 6.25 * height - 5 * age + 5;
-        } else {
-          bmr = 10 * weight + 6.25 * height - 5 * age - 161;
-        }
-
-        // Activity multiplier
-        const activityMultipliers = {
-          sedentary: 1.2,
-          light: 1.375,
-          moderate: 1.55,
-          active: 1.725,
-          "very active": 1.9,
-        };
-
-        const tdee =
-          bmr *
-          activityMultipliers[
-            data.activityLevel as keyof typeof activityMultipliers
-          ];
-
-        // Goal adjustment
-        let calories = tdee;
-        if (data.goal === "lose_weight") calories -= 500;
-        if (data.goal === "gain_weight" || data.goal === "gain_muscle")
-          calories += 500;
-
-        // Protein: 1.6-2.2g per kg body weight
-        const protein = Math.round(weight * 1.8);
-
-        return {
-          calories: Math.round(calories),
-          protein,
-        };
-      };
-
-      const calculatedGoals = calculateGoals();
-
-      // Create user profile in database
-      const profileData = {
-        user: user.id,
-        target_calories: data.customCalories || calculatedGoals.calories,
-        target_protein_g: data.customProtein || calculatedGoals.protein,
-        weight_kg: data.weight,
-        age: data.age,
-        height_cm: data.height,
-        gender: data.gender,
-        activity_level: data.activityLevel,
-        goal: data.goal,
-      };
-
-      console.log("Creating profile data:", profileData);
-
-      await pb.collection(Collections.UserProfiles).create(profileData);
+      // the server computes the targets unless custom values were entered
+      const profile = await createUserProfile(user.id, data);
 
       console.log("Profile created successfully");
 
       // Convert to UserGoals format for local state
       const goals: UserGoals = {
-        target_calories: data.customCalories || calculatedGoals.calories,
-        target_protein_g: data.customProtein || calculatedGoals.protein,
-        weight: data.weight, // Note: this maps to weight_kg in DB
-        age: data.age,
+        target_calories: profile.target_calories || 2000,
+        target_protein_g: profile.target_protein_g || 150,
+        weight: profile.weight_kg || data.weight,
+        age: profile.age || data.age,
       };
 
       setUserGoals(goals);
@@ -634,18 +588,15 @@ export default function CalorieTracker() {
     }
   };
 
-  const handleActivitySubmit = async (data: {
-    steps?: number;
-    durationMinutes?: number;
-    caloriesBurned: number;
-  }) => {
+  const handleActivitySubmit = async (data: ActivityLogData) => {
     try {
       await pb.collection(Collections.ActivityLogs).create({
         user: user?.id,
-        activity_type: "walking",
+        activity_type: data.activityType,
+        custom_name: data.customName,
+        met: data.met,
         steps: data.steps,
         duration_minutes: data.durationMinutes,
-        calories_burned: data.caloriesBurned,
       });
 
       await loadActivityLogs();
@@ -654,6 +605,15 @@ export default function CalorieTracker() {
     }
   };
 
+  const handleActivityImport = async (file: File) => {
+    try {
+      await importWorkoutFile(file);
+      await loadActivityLogs();
+    } catch (error) {
+      console.error("Error importing workout:", error);
+    }
+  };
+
   // Check for daily reset and clear old data on mount
   useEffect(() => {
     const currentDate = new Date().toDateString();
@@ -1084,7 +1044,7 @@ export default function CalorieTracker() {
           open={showActivityModal}
           onClose={() => setShowActivityModal(false)}
           onSubmit={handleActivitySubmit}
-          userWeightKg={userGoals.weight}
+          onImport={handleActivityImport}
         />
       )}
     </div>
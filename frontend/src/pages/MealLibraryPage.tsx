@@ -1,10 +1,11 @@
 import { useState, useEffect, useCallback } from "react";
-import { ArrowLeft, BookOpen, Loader2, Plus } from "lucide-react";
+import { ArrowLeft, BookOpen, Loader2, Plus, Search } from "lucide-react";
 import { Button } from "../components/ui/button";
 import { Card, CardContent } from "../components/ui/card";
 import { Badge } from "../components/ui/badge";
+import { Input } from "../components/ui/input";
 import { useAuth } from "../contexts/AuthContext";
-import pb from "../lib/pocketbase";
+import pb, { searchMeals } from "../lib/pocketbase";
 import { Collections } from "@/types/pocketbase-types";
 import { MealTemplate } from "@/types/common";
 
@@ -17,13 +18,36 @@ export default function MealLibraryPage({ onBack, onMealLogged }: MealLibraryPag
   const [meals, setMeals] = useState<MealTemplate[]>([]);
   const [isLoading, setIsLoading] = useState(true);
   const [loggingMealId, setLoggingMealId] = useState<string | null>(null);
+  const [searchQuery, setSearchQuery] = useState("");
   const { user } = useAuth();
 
-  const loadMeals = useCallback(async () => {
+  const loadMeals = useCallback(async (query: string) => {
     if (!user) return;
 
     try {
       setIsLoading(true);
+
+      if (query) {
+        // keep the ranking of the search
+        const results = await searchMeals(query);
+        if (results.length === 0) {
+          setMeals([]);
+          return;
+        }
+
+        const records = await pb.collection("meal_templates").getFullList({
+          filter: results.map((meal) => `id = "${meal.id}"`).join(" || "),
+        });
+        const byId = new Map(records.map((record) => [record.id, record]));
+
+        setMeals(
+          results
+            .map((meal) => byId.get(meal.id))
+            .filter(Boolean) as unknown as MealTemplate[],
+        );
+        return;
+      }
+
       const records = await pb.collection("meal_templates").getList(1, 50, {
         filter: `user = "${user.id}" && (is_primary_in_group = true || linked_meal_template_id = "")`,
         sort: "-created",
@@ -38,8 +62,9 @@ export default function MealLibraryPage({ onBack, onMealLogged }: MealLibraryPag
   }, [user]);
 
   useEffect(() => {
-    loadMeals();
-  }, [loadMeals]);
+    const timeout = setTimeout(() => loadMeals(searchQuery.trim()), searchQuery ? 400 : 0);
+    return () => clearTimeout(timeout);
+  }, [loadMeals, searchQuery]);
 
   const handleLogMeal = async (mealTemplateId: string) => {
     if (!user) return;
@@ -87,6 +112,15 @@ export default function MealLibraryPage({ onBack, onMealLogged }: MealLibraryPag
             <h1 className="text-xl font-semibold">My Meals</h1>
           </div>
         </div>
+        <div className="relative px-4 pb-4">
+          <Search className="absolute left-7 top-2.5 h-4 w-4 text-muted-foreground" />
+          <Input
+            value={searchQuery}
+            onChange={(e) => setSearchQuery(e.target.value)}
+            placeholder="Search meals, e.g. thai curry or ramen"
+            className="pl-9"
+          />
+        </div>
       </div>
 
       <div className="p-4">
@@ -99,7 +133,9 @@ export default function MealLibraryPage({ onBack, onMealLogged }: MealLibraryPag
           <div className="flex flex-col items-center justify-center py-12">
             <BookOpen className="h-12 w-12 text-muted-foreground mb-4" />
             <p className="text-center text-muted-foreground">
-              No meals yet. Start logging meals to build your library!
+              {searchQuery
+                ? "No meals match your search."
+                : "No meals yet. Start logging meals to build your library!"}
             </p>
           </div>
         ) : (
@@ -1,4 +1,4 @@
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { Button } from "../components/ui/button";
 import { Input } from "../components/ui/input";
 import { Label } from "../components/ui/label";
@@ -10,8 +10,14 @@ import {
 } from "../components/ui/card";
 import { User, Target, Calculator, ArrowLeft } from "lucide-react";
 import { ThemeToggle } from "../components/theme-toggle";
-import { OnboardingData, OnboardingFormData } from "../types/common";
+import {
+  NutritionTargets,
+  OnboardingData,
+  OnboardingFormData,
+} from "../types/common";
+import { previewTargets } from "../lib/pocketbase";
 import { 
+  UserProfilesBmrFormulaOptions,
   UserProfilesGenderOptions, 
   UserProfilesActivityLevelOptions, 
   UserProfilesGoalOptions 
@@ -34,70 +40,50 @@ export default function OnboardingPage({
     gender: UserProfilesGenderOptions.male,
     activity: UserProfilesActivityLevelOptions.moderate,
     goal: UserProfilesGoalOptions.maintain,
+    bmrFormula: UserProfilesBmrFormulaOptions.mifflin_st_jeor,
+    bodyFatPercent: "",
     customCalories: "",
     customProtein: "",
   });
+  const [targets, setTargets] = useState<NutritionTargets | null>(null);
 
   const handleInputChange = (field: string, value: string) => {
     setFormData((prev) => ({ ...prev, [field]: value }));
   };
 
-  const calculateGoals = () => {
-    const age = Number.parseInt(formData.age);
-    const weight = Number.parseInt(formData.weight);
-    const height = Number.parseInt(formData.height);
-
-    // Simple BMR calculation (Mifflin-St Jeor)
-    let bmr: number;
-    if (formData.gender === "male") {
-      bmr = 10 * weight + 6.25 * height - 5 * age + 5;
-    } else {
-      bmr = 10 * weight + 6.25 * height - 5 * age - 161;
-    }
-
-    // Activity multiplier
-    const activityMultipliers = {
-      sedentary: 1.2,
-      light: 1.375,
-      moderate: 1.55,
-      active: 1.725,
-      "very active": 1.9,
-    };
-
-    const tdee = bmr * activityMultipliers[formData.activity];
-
-    // Goal adjustment
-    let calories = tdee;
-    if (formData.goal === "lose_weight") calories -= 500;
-    if (formData.goal === "gain_weight" || formData.goal === "gain_muscle")
-      calories += 500;
+  const buildOnboardingData = (): OnboardingData => ({
+    age: parseInt(formData.age),
+    weight: parseInt(formData.weight),
+    height: parseInt(formData.height),
+    gender: formData.gender,
+    activityLevel: formData.activity,
+    goal: formData.goal,
+    bmrFormula: formData.bmrFormula,
+    bodyFatPercent: formData.bodyFatPercent
+      ? parseFloat(formData.bodyFatPercent)
+      : undefined,
+    customCalories: formData.customCalories
+      ? parseInt(formData.customCalories)
+      : undefined,
+    customProtein: formData.customProtein
+      ? parseInt(formData.customProtein)
+      : undefined,
+  });
 
-    // Protein: 1.6-2.2g per kg body weight
-    const protein = Math.round(weight * 1.8);
+  // the targets come from the server so they match what the profile gets
+  useEffect(() => {
+    if (step !== 3) return;
 
-    return {
-      calories: Math.round(calories),
-      protein,
-    };
-  };
+    previewTargets(buildOnboardingData())
+      .then(setTargets)
+      .catch((error) => {
+        console.error("Failed to calculate targets:", error);
+        setTargets(null);
+      });
+  }, [step]);
 
   const handleComplete = () => {
-    const onboardingData: OnboardingData = {
-      age: parseInt(formData.age),
-      weight: parseInt(formData.weight),
-      height: parseInt(formData.height),
-      gender: formData.gender,
-      activityLevel: formData.activity,
-      goal: formData.goal,
-      customCalories: formData.customCalories
-        ? parseInt(formData.customCalories)
-        : undefined,
-      customProtein: formData.customProtein
-        ? parseInt(formData.customProtein)
-        : undefined,
-    };
-
-    onComplete(onboardingData);
+    onComplete(buildOnboardingData());
   };
 
   return (
@@ -191,6 +177,34 @@ export default function OnboardingPage({
                   >
                     <option value="male">Male</option>
                     <option value="female">Female</option>
+                    <option value="neutral">Other / prefer not to say</option>
+                  </select>
+                </div>
+                <div className="space-y-2">
+                  <Label htmlFor="bodyFat">Body fat % (optional)</Label>
+                  <Input
+                    id="bodyFat"
+                    type="number"
+                    inputMode="decimal"
+                    placeholder="20"
+                    value={formData.bodyFatPercent}
+                    onChange={(e) =>
+                      handleInputChange("bodyFatPercent", e.target.value)
+                    }
+                  />
+                </div>
+                <div className="space-y-2">
+                  <Label>BMR formula</Label>
+                  <select
+                    className="w-full p-2 border border-input rounded-md bg-background text-foreground"
+                    value={formData.bmrFormula}
+                    onChange={(e) =>
+                      handleInputChange("bmrFormula", e.target.value)
+                    }
+                  >
+                    <option value="mifflin_st_jeor">Mifflin-St Jeor (recommended)</option>
+                    <option value="katch_mcardle">Katch-McArdle (needs body fat %)</option>
+                    <option value="harris_benedict">Harris-Benedict</option>
                   </select>
                 </div>
                 <Button
@@ -262,10 +276,10 @@ export default function OnboardingPage({
                     Calculated Targets
                   </h3>
                   <p className="text-sm text-muted-foreground">
-                    Calories: {calculateGoals().calories} kcal/day
+                    Calories: {targets ? targets.calories : "…"} kcal/day
                   </p>
                   <p className="text-sm text-muted-foreground">
-                    Protein: {calculateGoals().protein}g/day
+                    Protein: {targets ? targets.protein_g : "…"}g/day
                   </p>
                 </div>
 
@@ -284,7 +298,7 @@ export default function OnboardingPage({
                     <Input
                       id="customCalories"
                       type="number"
-                      placeholder={calculateGoals().calories.toString()}
+                      placeholder={targets ? String(targets.calories) : ""}
                       value={formData.customCalories}
                       onChange={(e) =>
                         handleInputChange("customCalories", e.target.value)
@@ -296,7 +310,7 @@ export default function OnboardingPage({
                     <Input
                       id="customProtein"
                       type="number"
-                      placeholder={calculateGoals().protein.toString()}
+                      placeholder={targets ? String(targets.protein_g) : ""}
                       value={formData.customProtein}
                       onChange={(e) =>
                         handleInputChange("customProtein", e.target.value)
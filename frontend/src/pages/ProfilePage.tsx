@@ -1,5 +1,5 @@
-import { useState, useEffect, useRef } from "react";
-import { Loader2, User, Target, Save, ArrowLeft, LogOut, Info, ChevronDown } from "lucide-react";
+import { useState, useEffect, useRef, type ChangeEvent } from "react";
+import { Loader2, User, Target, Save, ArrowLeft, LogOut, Info, ChevronDown, Upload, Download, Link } from "lucide-react";
 import { Button } from "../components/ui/button";
 import {
   Card,
@@ -14,15 +14,30 @@ import {
   CollapsibleContent,
   CollapsibleTrigger,
 } from "../components/ui/collapsible";
+import {
+  Select,
+  SelectContent,
+  SelectItem,
+  SelectTrigger,
+  SelectValue,
+} from "../components/ui/select";
 import { ThemeToggle } from "../components/theme-toggle";
 import { useAuth } from "../contexts/AuthContext";
 import { UserProfile } from "../types/common";
 import {
   UserProfilesGenderOptions,
   UserProfilesActivityLevelOptions,
-  UserProfilesGoalOptions
+  UserProfilesGoalOptions,
+  UserProfilesAutoMatchModeOptions,
+  UserProfilesBmrFormulaOptions,
 } from "../types/pocketbase-types";
-import pb from "../lib/pocketbase";
+import pb, {
+  deleteAccount,
+  downloadAccountExport,
+  downloadDiaryExport,
+  importDiaryExport,
+  importHealthExport,
+} from "../lib/pocketbase";
 interface ProfilePageProps {
   onBack?: () => void;
 }
@@ -43,7 +58,10 @@ export default function ProfilePage({ onBack }: ProfilePageProps) {
   const [error, setError] = useState("");
   const [success, setSuccess] = useState("");
   const [tipsOpen, setTipsOpen] = useState(false);
+  const [isImporting, setIsImporting] = useState(false);
   const hasLoadedRef = useRef(false);
+  const importInputRef = useRef<HTMLInputElement>(null);
+  const diaryInputRef = useRef<HTMLInputElement>(null);
 
   const { user, logout } = useAuth();
 
@@ -80,6 +98,11 @@ export default function ProfilePage({ onBack }: ProfilePageProps) {
           gender: userProfile.gender || UserProfilesGenderOptions.male,
           activity_level: userProfile.activity_level || UserProfilesActivityLevelOptions.moderate,
           goal: userProfile.goal || UserProfilesGoalOptions.maintain,
+          bmr_formula: userProfile.bmr_formula || UserProfilesBmrFormulaOptions.mifflin_st_jeor,
+          body_fat_percent: userProfile.body_fat_percent || 0,
+          custom_targets: userProfile.custom_targets || false,
+          auto_match_mode: userProfile.auto_match_mode || UserProfilesAutoMatchModeOptions.auto,
+          auto_match_distance: userProfile.auto_match_distance || 0.1,
         });
       }
     } catch (error: unknown) {
@@ -98,9 +121,103 @@ export default function ProfilePage({ onBack }: ProfilePageProps) {
     setProfile((prev) => ({
       ...prev,
       [field]: numValue,
+      // manually entered targets are kept instead of being recomputed
+      ...(field === "target_calories" || field === "target_protein_g"
+        ? { custom_targets: true }
+        : {}),
     }));
   };
 
+  const handleImport = async (e: ChangeEvent<HTMLInputElement>) => {
+    const file = e.target.files?.[0];
+    e.target.value = "";
+    if (!file) return;
+
+    setIsImporting(true);
+    setError("");
+    setSuccess("");
+
+    try {
+      const report = await importHealthExport(file);
+      setSuccess(
+        `Imported ${report.steps.created + report.steps.updated} days of steps, ` +
+          `${report.weights.created} weigh-ins and ${report.workouts.created} workouts`,
+      );
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to import export");
+    } finally {
+      setIsImporting(false);
+    }
+  };
+
+  const handleDiaryImport = async (e: ChangeEvent<HTMLInputElement>) => {
+    const file = e.target.files?.[0];
+    e.target.value = "";
+    if (!file) return;
+
+    setIsImporting(true);
+    setError("");
+    setSuccess("");
+
+    try {
+      // preview first, nothing is saved until confirmed
+      const preview = await importDiaryExport(file, true);
+      if (preview.entries.created === 0) {
+        setSuccess("Nothing new to import from this diary");
+        return;
+      }
+
+      const confirmed = window.confirm(
+        `Import ${preview.entries.created} diary entries (${preview.meals.created} new meals) ` +
+          `from ${preview.from} to ${preview.to}?`,
+      );
+      if (!confirmed) return;
+
+      const report = await importDiaryExport(file, false);
+      setSuccess(`Imported ${report.entries.created} diary entries`);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to import diary");
+    } finally {
+      setIsImporting(false);
+    }
+  };
+
+  const handleAccountExport = async () => {
+    setError("");
+    try {
+      await downloadAccountExport();
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to export account");
+    }
+  };
+
+  const handleDeleteAccount = async () => {
+    const confirmed = window.confirm(
+      "Delete your account and all of your meals, photos, activities and weigh-ins? This cannot be undone.",
+    );
+    if (!confirmed) return;
+
+    setError("");
+    try {
+      const report = await deleteAccount();
+      if (!report.verified) {
+        window.alert("Your account was deleted, but some data could not be removed yet. We will follow up.");
+      }
+      logout();
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to delete account");
+    }
+  };
+
+  const handleExport = async (format: "csv" | "json") => {
+    setError("");
+    try {
+      await downloadDiaryExport(format);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to export diary");
+    }
+  };
+
   const handleSave = async () => {
     setIsSaving(true);
     setError("");
@@ -115,11 +232,24 @@ export default function ProfilePage({ onBack }: ProfilePageProps) {
         target_protein_g: profile.target_protein_g,
         weight_kg: profile.weight_kg,
         age: profile.age,
+        bmr_formula: profile.bmr_formula,
+        body_fat_percent: profile.body_fat_percent || 0,
+        custom_targets: profile.custom_targets || false,
+        auto_match_mode: profile.auto_match_mode,
+        auto_match_distance: profile.auto_match_distance,
+        timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
       };
 
       if (profile.id) {
-        // Update existing profile
-        await pb.collection("user_profiles").update(profile.id, profileData);
+        // Update existing profile, targets may have been recomputed
+        const updated = await pb
+          .collection("user_profiles")
+          .update(profile.id, profileData);
+        setProfile((prev) => ({
+          ...prev,
+          target_calories: updated.target_calories,
+          target_protein_g: updated.target_protein_g,
+        }));
       } else {
         // Create new profile
         const newProfile = await pb
@@ -251,6 +381,58 @@ export default function ProfilePage({ onBack }: ProfilePageProps) {
                 />
               </div>
             </div>
+            <div className="grid grid-cols-2 gap-3">
+              <div className="space-y-2">
+                <Label htmlFor="body-fat">Body fat %</Label>
+                <Input
+                  id="body-fat"
+                  type="number"
+                  inputMode="decimal"
+                  step="0.1"
+                  value={profile.body_fat_percent || ""}
+                  onChange={(e) =>
+                    setProfile((prev) => ({
+                      ...prev,
+                      body_fat_percent: parseFloat(e.target.value) || 0,
+                    }))
+                  }
+                  min="3"
+                  max="70"
+                />
+              </div>
+              <div className="space-y-2">
+                <Label htmlFor="bmr-formula">BMR formula</Label>
+                <Select
+                  value={profile.bmr_formula || UserProfilesBmrFormulaOptions.mifflin_st_jeor}
+                  onValueChange={(value) =>
+                    setProfile((prev) => ({
+                      ...prev,
+                      bmr_formula: value as UserProfilesBmrFormulaOptions,
+                      // picking a formula means the targets should follow it
+                      custom_targets: false,
+                    }))
+                  }
+                >
+                  <SelectTrigger id="bmr-formula">
+                    <SelectValue />
+                  </SelectTrigger>
+                  <SelectContent>
+                    <SelectItem value={UserProfilesBmrFormulaOptions.mifflin_st_jeor}>
+                      Mifflin-St Jeor
+                    </SelectItem>
+                    <SelectItem value={UserProfilesBmrFormulaOptions.katch_mcardle}>
+                      Katch-McArdle
+                    </SelectItem>
+                    <SelectItem value={UserProfilesBmrFormulaOptions.harris_benedict}>
+                      Harris-Benedict
+                    </SelectItem>
+                  </SelectContent>
+                </Select>
+              </div>
+            </div>
+            <p className="text-xs text-muted-foreground">
+              Katch-McArdle uses your body fat and suits lean or muscular builds.
+            </p>
           </CardContent>
         </Card>
 
@@ -263,6 +445,33 @@ export default function ProfilePage({ onBack }: ProfilePageProps) {
             </CardTitle>
           </CardHeader>
           <CardContent className="space-y-4">
+            <div className="space-y-2">
+              <Label htmlFor="targets-mode">Targets</Label>
+              <Select
+                value={profile.custom_targets ? "custom" : "calculated"}
+                onValueChange={(value) =>
+                  setProfile((prev) => ({
+                    ...prev,
+                    custom_targets: value === "custom",
+                  }))
+                }
+              >
+                <SelectTrigger id="targets-mode">
+                  <SelectValue />
+                </SelectTrigger>
+                <SelectContent>
+                  <SelectItem value="calculated">
+                    Calculate from my profile
+                  </SelectItem>
+                  <SelectItem value="custom">
+                    Use my own values
+                  </SelectItem>
+                </SelectContent>
+              </Select>
+              <p className="text-xs text-muted-foreground">
+                Calculated targets follow your weight, activity and goal. Editing a target below switches to your own values.
+              </p>
+            </div>
             <div className="space-y-2">
               <Label htmlFor="calories">Daily Calories Target</Label>
               <Input
@@ -298,6 +507,147 @@ export default function ProfilePage({ onBack }: ProfilePageProps) {
           </CardContent>
         </Card>
 
+        {/* Meal Matching */}
+        <Card>
+          <CardHeader className="pb-3">
+            <CardTitle className="text-lg flex items-center gap-2">
+              <Link className="h-5 w-5 text-primary" />
+              Meal Matching
+            </CardTitle>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            <div className="space-y-2">
+              <Label htmlFor="auto-match-mode">When a photo looks like an earlier meal</Label>
+              <Select
+                value={profile.auto_match_mode || UserProfilesAutoMatchModeOptions.auto}
+                onValueChange={(value) =>
+                  setProfile((prev) => ({
+                    ...prev,
+                    auto_match_mode: value as UserProfilesAutoMatchModeOptions,
+                  }))
+                }
+              >
+                <SelectTrigger id="auto-match-mode">
+                  <SelectValue />
+                </SelectTrigger>
+                <SelectContent>
+                  <SelectItem value={UserProfilesAutoMatchModeOptions.auto}>
+                    Reuse its nutrition
+                  </SelectItem>
+                  <SelectItem value={UserProfilesAutoMatchModeOptions.suggest}>
+                    Analyze and suggest the match
+                  </SelectItem>
+                  <SelectItem value={UserProfilesAutoMatchModeOptions.off}>
+                    Always analyze
+                  </SelectItem>
+                </SelectContent>
+              </Select>
+            </div>
+            <div className="space-y-2">
+              <Label htmlFor="auto-match-distance">Match distance</Label>
+              <Input
+                id="auto-match-distance"
+                type="number"
+                inputMode="decimal"
+                step="0.01"
+                min="0.01"
+                max="1"
+                value={profile.auto_match_distance || ""}
+                onChange={(e) =>
+                  setProfile((prev) => ({
+                    ...prev,
+                    auto_match_distance: parseFloat(e.target.value) || 0,
+                  }))
+                }
+                disabled={profile.auto_match_mode === UserProfilesAutoMatchModeOptions.off}
+              />
+              <p className="text-xs text-muted-foreground">
+                Lower is stricter. 0.1 only matches nearly identical photos.
+              </p>
+            </div>
+          </CardContent>
+        </Card>
+
+        {/* Import / Export */}
+        <Card>
+          <CardHeader className="pb-3">
+            <CardTitle className="text-lg flex items-center gap-2">
+              <Upload className="h-5 w-5 text-primary" />
+              Your Data
+            </CardTitle>
+          </CardHeader>
+          <CardContent className="space-y-2">
+            <p className="text-xs text-muted-foreground">
+              Upload an Apple Health export or a Google Takeout zip with your Fit data to import steps,
+              weight and workouts. Importing the same export again only adds what is new.
+            </p>
+            <input
+              ref={importInputRef}
+              type="file"
+              accept=".zip"
+              className="hidden"
+              onChange={handleImport}
+            />
+            <Button
+              variant="outline"
+              className="w-full"
+              onClick={() => importInputRef.current?.click()}
+              disabled={isImporting}
+            >
+              {isImporting ? (
+                <>
+                  <Loader2 className="h-4 w-4 mr-2 animate-spin" />
+                  Importing...
+                </>
+              ) : (
+                "Import Apple Health / Google Fit"
+              )}
+            </Button>
+            <p className="text-xs text-muted-foreground pt-2">
+              Bring your food diary over from a MyFitnessPal nutrition export or a Cronometer servings
+              export (CSV).
+            </p>
+            <input
+              ref={diaryInputRef}
+              type="file"
+              accept=".csv"
+              className="hidden"
+              onChange={handleDiaryImport}
+            />
+            <Button
+              variant="outline"
+              className="w-full"
+              onClick={() => diaryInputRef.current?.click()}
+              disabled={isImporting}
+            >
+              Import MyFitnessPal / Cronometer
+            </Button>
+            <p className="text-xs text-muted-foreground pt-2">
+              Download your food diary and activities.
+            </p>
+            <div className="flex gap-2">
+              <Button variant="outline" className="flex-1" onClick={() => handleExport("csv")}>
+                <Download className="h-4 w-4 mr-2" />
+                CSV
+              </Button>
+              <Button variant="outline" className="flex-1" onClick={() => handleExport("json")}>
+                <Download className="h-4 w-4 mr-2" />
+                JSON
+              </Button>
+            </div>
+            <p className="text-xs text-muted-foreground pt-2">
+              Download everything stored for your account, including meal photos, or delete it all.
+            </p>
+            <Button variant="outline" className="w-full" onClick={handleAccountExport}>
+              <Download className="h-4 w-4 mr-2" />
+              Download all my data
+            </Button>
+            <Button variant="destructive" className="w-full" onClick={handleDeleteAccount}>
+              Delete account
+            </Button>
+          </CardContent>
+        </Card>
+
         {/* Error/Success Messages */}
         {error && (
           <div className="bg-destructive/10 border border-destructive/20 rounded-md p-3">
@@ -8,7 +8,7 @@ import { ThemeToggle } from "../components/theme-toggle";
 import OnboardingPage from "./OnboardingPage";
 import { useAuth } from "../contexts/AuthContext";
 import { cn } from "../lib/utils";
-import { OnboardingData, UserGoals, SignupData } from "../types/common";
+import { OnboardingData, SignupData } from "../types/common";
 
 interface SignupPageProps {
   onSwitchToLogin?: () => void;
@@ -28,62 +28,13 @@ export default function SignupPage({ onSwitchToLogin }: SignupPageProps) {
 
   const { signup } = useAuth();
 
-  const calculateGoalsFromOnboarding = (data: OnboardingData): UserGoals => {
-    if (data.customCalories && data.customProtein) {
-      return {
-        target_calories: data.customCalories,
-        target_protein_g: data.customProtein,
-        weight: data.weight,
-        age: data.age,
-      };
-    }
-
-    // Calculate BMR
-    let bmr: number;
-    if (data.gender === "male") {
-      bmr = 10 * data.weight + 6.25 * data.height - 5 * data.age + 5;
-    } else {
-      bmr = 10 * data.weight + 6.25 * data.height - 5 * data.age - 161;
-    }
-
-    // Activity multipliers
-    const activityMultipliers = {
-      sedentary: 1.2,
-      light: 1.375,
-      moderate: 1.55,
-      active: 1.725,
-      "very active": 1.9,
-    };
-
-    const tdee = bmr * activityMultipliers[data.activityLevel];
-
-    // Goal adjustment
-    let calories = tdee;
-    if (data.goal === "lose_weight") calories -= 500;
-    if (data.goal === "gain_weight" || data.goal === "gain_muscle")
-      calories += 500;
-
-    // Protein calculation
-    const protein = Math.round(data.weight * 1.8);
-
-    return {
-      target_calories: Math.round(calories),
-      target_protein_g: protein,
-      weight: data.weight,
-      age: data.age,
-    };
-  };
-
   const handleOnboardingComplete = async (data: OnboardingData) => {
     setIsLoading(true);
     try {
-      // Calculate goals from onboarding data
-      const goals = calculateGoalsFromOnboarding(data);
-
+      // targets are computed server-side when the profile is created
       await signup({
         ...signupData,
         onboardingData: data,
-        userGoals: goals,
       });
     } catch (error: unknown) {
       setError(error instanceof Error ? error.message : "Signup failed. Please try again.");
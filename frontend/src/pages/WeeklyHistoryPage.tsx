@@ -116,10 +116,15 @@ export default function WeeklyHistoryPage({ onBack, userGoals }: WeeklyHistoryPa
       
       // Load all meals for the week
       const records = await pb.collection("meal_history").getList(1, 200, {
-        sort: "-created",
-        created: `>=${currentWeekStart.toISOString()} && <${weekEnd.toISOString()}`,
+        sort: "-consumed_at",
         expand: "meal",
-        filter: `adjustments != 'hidden'`,
+        filter: pb.filter(
+          "adjustments != 'hidden' && consumed_at >= {:weekStart} && consumed_at < {:weekEnd}",
+          {
+            weekStart: currentWeekStart.toISOString(),
+            weekEnd: weekEnd.toISOString(),
+          },
+        ),
       });
 
       const weeklyData: DayData[] = weekDays.map(date => {
@@ -130,7 +135,7 @@ export default function WeeklyHistoryPage({ onBack, userGoals }: WeeklyHistoryPa
 
         // Filter meals for this specific day
         const dayMeals = records.items.filter(record => {
-          const mealDate = new Date(record.created);
+          const mealDate = new Date(record.consumed_at || record.created);
           return mealDate >= dayStart && mealDate <= dayEnd;
         });
 
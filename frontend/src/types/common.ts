@@ -7,6 +7,7 @@ import type {
   UserProfilesGenderOptions,
   UserProfilesActivityLevelOptions,
   UserProfilesGoalOptions,
+  UserProfilesBmrFormulaOptions,
   MealTemplatesProcessingStatusOptions
 } from './pocketbase-types';
 
@@ -20,6 +21,7 @@ export type ActivityLog = ActivityLogsResponse;
 export type Gender = UserProfilesGenderOptions;
 export type ActivityLevel = UserProfilesActivityLevelOptions;
 export type Goal = UserProfilesGoalOptions;
+export type BmrFormula = UserProfilesBmrFormulaOptions;
 export type ProcessingStatus = MealTemplatesProcessingStatusOptions;
 
 export interface UserGoals {
@@ -29,6 +31,13 @@ export interface UserGoals {
   age: number
 }
 
+export interface NutritionTargets {
+  calories: number
+  protein_g: number
+  carbs_g: number
+  fat_g: number
+}
+
 export interface OnboardingData {
   age: number
   weight: number
@@ -36,6 +45,8 @@ export interface OnboardingData {
   gender: Gender
   activityLevel: ActivityLevel
   goal: Goal
+  bmrFormula: BmrFormula
+  bodyFatPercent?: number
   customCalories?: number
   customProtein?: number
 }
@@ -47,6 +58,8 @@ export interface OnboardingFormData {
   gender: Gender
   activity: ActivityLevel
   goal: Goal
+  bmrFormula: BmrFormula
+  bodyFatPercent: string
   customCalories: string
   customProtein: string
 }
@@ -56,7 +69,6 @@ export interface SignupData {
   password: string;
   passwordConfirm: string;
   name?: string;
-  userGoals?: UserGoals;
   onboardingData?: OnboardingData;
 }
 
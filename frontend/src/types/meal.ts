@@ -20,6 +20,7 @@ export interface MealEntry {
   created: string;
   updated: string;
   linkedMealTemplateId?: string;
+  suggestedMealTemplateId?: string;
   isPrimaryInGroup?: boolean;
   portionMultiplier?: number;
   calorieAdjustment?: number;
@@ -39,4 +40,25 @@ export interface SimilarMeal {
   ai_description: string;
   image_url?: string;
   created: string;
+  linked_meal_template_id: string;
+  is_primary_in_group: boolean;
+}
+
+export interface SimilarMealsPage {
+  page: number;
+  limit: number;
+  has_more: boolean;
+  items: SimilarMeal[];
+}
+
+export interface MealSearchHit extends SimilarMeal {
+  score: number;
+  sources: ("keyword" | "image")[];
+}
+
+export interface MealSearchPage {
+  page: number;
+  limit: number;
+  has_more: boolean;
+  items: MealSearchHit[];
 }
@@ -16,6 +16,9 @@ export enum Collections {
 	MealTemplates = "meal_templates",
 	UserProfiles = "user_profiles",
 	Users = "users",
+	WeightLogs = "weight_logs",
+	TdeeProposals = "tdee_proposals",
+	GoalPlans = "goal_plans",
 }
 
 // Alias types for improved usability
@@ -96,26 +99,50 @@ export type SuperusersRecord = {
 
 export enum ActivityLogsActivityTypeOptions {
 	"walking" = "walking",
+	"running" = "running",
+	"cycling" = "cycling",
+	"swimming" = "swimming",
+	"strength_training" = "strength_training",
+	"hiking" = "hiking",
+	"custom" = "custom",
 }
 export type ActivityLogsRecord = {
 	activity_type: ActivityLogsActivityTypeOptions
+	avg_heart_rate?: number
 	calories_burned?: number
 	created?: IsoDateString
+	custom_name?: string
+	distance_km?: number
 	duration_minutes?: number
+	elevation_gain_m?: number
+	external_id?: string
 	id: string
+	max_heart_rate?: number
+	met?: number
+	source_file?: string
+	started_at?: IsoDateString
 	steps?: number
 	updated?: IsoDateString
 	user: RecordIdString
 }
 
+export enum MealHistoryMealSlotOptions {
+	"breakfast" = "breakfast",
+	"lunch" = "lunch",
+	"dinner" = "dinner",
+	"snack" = "snack",
+}
 export type MealHistoryRecord = {
 	adjustments?: string
 	calorie_adjustment?: number
 	carb_adjustment?: number
+	consumed_at?: IsoDateString
 	created?: IsoDateString
+	external_id?: string
 	fat_adjustment?: number
 	id: string
 	meal?: RecordIdString
+	meal_slot?: MealHistoryMealSlotOptions
 	name?: string
 	portion_multiplier?: number
 	protein_adjustment?: number
@@ -129,20 +156,32 @@ export enum MealTemplatesProcessingStatusOptions {
 	"completed" = "completed",
 	"failed" = "failed",
 }
+
+export enum MealTemplatesMealTypeOptions {
+	"breakfast" = "breakfast",
+	"lunch" = "lunch",
+	"dinner" = "dinner",
+	"snack" = "snack",
+}
 export type MealTemplatesRecord = {
 	ai_description?: string
 	calorie_uncertainty_percent?: number
 	carbs_uncertainty_percent?: number
 	created?: IsoDateString
 	description?: string
+	external_id?: string
 	fat_uncertainty_percent?: number
 	id: string
 	image?: string
+	image_hash?: string
 	is_primary_in_group?: boolean
 	linked_meal_template_id?: RecordIdString
+	meal_type?: MealTemplatesMealTypeOptions
 	name?: string
 	processing_status?: MealTemplatesProcessingStatusOptions
 	protein_uncertainty_percent?: number
+	suggested_match_distance?: number
+	suggested_meal_template_id?: RecordIdString
 	total_calories?: number
 	total_carbs_g?: number
 	total_fat_g?: number
@@ -154,6 +193,13 @@ export type MealTemplatesRecord = {
 export enum UserProfilesGenderOptions {
 	"male" = "male",
 	"female" = "female",
+	"neutral" = "neutral",
+}
+
+export enum UserProfilesBmrFormulaOptions {
+	"mifflin_st_jeor" = "mifflin_st_jeor",
+	"katch_mcardle" = "katch_mcardle",
+	"harris_benedict" = "harris_benedict",
 }
 
 export enum UserProfilesActivityLevelOptions {
@@ -170,24 +216,49 @@ export enum UserProfilesGoalOptions {
 	"gain_weight" = "gain_weight",
 	"gain_muscle" = "gain_muscle",
 }
-export type UserProfilesRecord = {
+export enum UserProfilesAutoMatchModeOptions {
+	"auto" = "auto",
+	"suggest" = "suggest",
+	"off" = "off",
+}
+
+export type UserProfilesRecord<Tmeal_slot_windows = unknown, Ttarget_schedule = unknown> = {
 	activity_level: UserProfilesActivityLevelOptions
 	age: number
+	auto_match_distance?: number
+	auto_match_mode?: UserProfilesAutoMatchModeOptions
+	bmr_formula?: UserProfilesBmrFormulaOptions
+	body_fat_percent?: number
 	created?: IsoDateString
+	custom_targets?: boolean
 	display_name?: string
 	gender: UserProfilesGenderOptions
 	goal: UserProfilesGoalOptions
 	height_cm: number
 	id: string
+	meal_slot_windows?: null | Tmeal_slot_windows
 	target_calories?: number
 	target_carbs_g?: number
 	target_fat_g?: number
 	target_protein_g?: number
+	target_schedule?: null | Ttarget_schedule
+	timezone?: string
 	updated?: IsoDateString
 	user?: RecordIdString
 	weight_kg: number
 }
 
+export type WeightLogsRecord = {
+	created?: IsoDateString
+	external_id?: string
+	id: string
+	measured_at?: IsoDateString
+	note?: string
+	updated?: IsoDateString
+	user: RecordIdString
+	weight_kg: number
+}
+
 export type UsersRecord = {
 	avatar?: string
 	created?: IsoDateString
@@ -201,6 +272,47 @@ export type UsersRecord = {
 	verified?: boolean
 }
 
+export enum TdeeProposalsStatusOptions {
+	"pending" = "pending",
+	"accepted" = "accepted",
+	"rejected" = "rejected",
+	"superseded" = "superseded",
+}
+export type TdeeProposalsRecord = {
+	created?: IsoDateString
+	current_calories?: number
+	estimated_tdee: number
+	formula_tdee?: number
+	id: string
+	logged_days?: number
+	proposed_calories: number
+	status: TdeeProposalsStatusOptions
+	updated?: IsoDateString
+	user: RecordIdString
+	window_end: IsoDateString
+	window_start: IsoDateString
+}
+
+export enum GoalPlansStatusOptions {
+	"active" = "active",
+	"completed" = "completed",
+	"abandoned" = "abandoned",
+}
+export type GoalPlansRecord = {
+	created?: IsoDateString
+	daily_calorie_delta?: number
+	id: string
+	start_date?: IsoDateString
+	start_weight_kg?: number
+	status?: GoalPlansStatusOptions
+	target_date: IsoDateString
+	target_weight_kg: number
+	updated?: IsoDateString
+	user: RecordIdString
+	warning?: string
+	weekly_rate_kg?: number
+}
+
 // Response types include system fields and match responses from the PocketBase API
 export type AuthoriginsResponse<Texpand = unknown> = Required<AuthoriginsRecord> & BaseSystemFields<Texpand>
 export type ExternalauthsResponse<Texpand = unknown> = Required<ExternalauthsRecord> & BaseSystemFields<Texpand>
@@ -210,8 +322,11 @@ export type SuperusersResponse<Texpand = unknown> = Required<SuperusersRecord> &
 export type ActivityLogsResponse<Texpand = unknown> = Required<ActivityLogsRecord> & BaseSystemFields<Texpand>
 export type MealHistoryResponse<Texpand = unknown> = Required<MealHistoryRecord> & BaseSystemFields<Texpand>
 export type MealTemplatesResponse<Texpand = unknown> = Required<MealTemplatesRecord> & BaseSystemFields<Texpand>
-export type UserProfilesResponse<Texpand = unknown> = Required<UserProfilesRecord> & BaseSystemFields<Texpand>
+export type UserProfilesResponse<Tmeal_slot_windows = unknown, Ttarget_schedule = unknown, Texpand = unknown> = Required<UserProfilesRecord<Tmeal_slot_windows, Ttarget_schedule>> & BaseSystemFields<Texpand>
+export type WeightLogsResponse<Texpand = unknown> = Required<WeightLogsRecord> & BaseSystemFields<Texpand>
 export type UsersResponse<Texpand = unknown> = Required<UsersRecord> & AuthSystemFields<Texpand>
+export type TdeeProposalsResponse<Texpand = unknown> = Required<TdeeProposalsRecord> & BaseSystemFields<Texpand>
+export type GoalPlansResponse<Texpand = unknown> = Required<GoalPlansRecord> & BaseSystemFields<Texpand>
 
 // Types containing all Records and Responses, useful for creating typing helper functions
 
@@ -226,6 +341,9 @@ export type CollectionRecords = {
 	meal_templates: MealTemplatesRecord
 	user_profiles: UserProfilesRecord
 	users: UsersRecord
+	weight_logs: WeightLogsRecord
+	tdee_proposals: TdeeProposalsRecord
+	goal_plans: GoalPlansRecord
 }
 
 export type CollectionResponses = {
@@ -239,6 +357,9 @@ export type CollectionResponses = {
 	meal_templates: MealTemplatesResponse
 	user_profiles: UserProfilesResponse
 	users: UsersResponse
+	weight_logs: WeightLogsResponse
+	tdee_proposals: TdeeProposalsResponse
+	goal_plans: GoalPlansResponse
 }
 
 // Type for usage with type asserted PocketBase instance
@@ -255,4 +376,7 @@ export type TypedPocketBase = PocketBase & {
 	collection(idOrName: 'meal_templates'): RecordService<MealTemplatesResponse>
 	collection(idOrName: 'user_profiles'): RecordService<UserProfilesResponse>
 	collection(idOrName: 'users'): RecordService<UsersResponse>
+	collection(idOrName: 'weight_logs'): RecordService<WeightLogsResponse>
+	collection(idOrName: 'tdee_proposals'): RecordService<TdeeProposalsResponse>
+	collection(idOrName: 'goal_plans'): RecordService<GoalPlansResponse>
 }
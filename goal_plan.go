@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/ignoxx/caloriemate/nutrition"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// prepareGoalPlan fills in the plan's start from the profile, derives the
+// required rate and calorie delta and refuses unsafe plans.
+func prepareGoalPlan(app core.App, record *core.Record) error {
+	if record.GetString("status") == "" {
+		record.Set("status", "active")
+	}
+
+	if record.GetDateTime("start_date").IsZero() {
+		record.Set("start_date", time.Now())
+	}
+
+	if record.GetFloat("start_weight_kg") == 0 {
+		profile, err := app.FindFirstRecordByData(types.COL_USER_PROFILES, "user", record.GetString("user"))
+		if err != nil {
+			return apis.NewBadRequestError("A start weight or user profile is required", err)
+		}
+		record.Set("start_weight_kg", profile.GetFloat("weight_kg"))
+	}
+
+	plan := nutrition.GoalPlanFromRecord(record)
+
+	warning, err := plan.Check()
+	if err != nil {
+		return apis.NewBadRequestError("Invalid goal plan: "+err.Error(), err)
+	}
+
+	record.Set("weekly_rate_kg", math.Round(plan.WeeklyRate()*100)/100)
+	record.Set("daily_calorie_delta", math.Round(plan.DailyCalorieDelta()))
+	record.Set("warning", warning)
+
+	return nil
+}
+
+// activateGoalPlan makes the plan the user's only active one and refreshes
+// the profile's targets from it.
+func activateGoalPlan(app core.App, record *core.Record) error {
+	userID := record.GetString("user")
+
+	// never touch another user's plans or targets through a reassigned plan
+	if owner := record.Original().GetString("user"); owner != "" && owner != userID {
+		return errors.New("goal plan was moved to another user")
+	}
+
+	if record.GetString("status") == "active" {
+		_, err := app.DB().Update(types.COL_GOAL_PLANS,
+			dbx.Params{"status": "abandoned"},
+			dbx.And(
+				dbx.HashExp{"user": userID, "status": "active"},
+				dbx.Not(dbx.HashExp{"id": record.Id}),
+			),
+		).Execute()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := refreshGoalTargets(app, userID); err != nil {
+		return err
+	}
+
+	slog.Info("Applied goal plan", "userId", userID, "planId", record.Id, "status", record.GetString("status"))
+	return nil
+}
+
+// refreshGoalTargets re-saves the user's profile, whose hooks recompute the
+// targets from the currently active plan, or without one.
+func refreshGoalTargets(app core.App, userID string) error {
+	profile, err := app.FindFirstRecordByData(types.COL_USER_PROFILES, "user", userID)
+	if err != nil {
+		return nil
+	}
+
+	return app.Save(profile)
+}
+
+// completeExpiredGoalPlans marks active plans past their target date as
+// completed, which drops their calorie delta from the owner's targets.
+func completeExpiredGoalPlans(app core.App) error {
+	plans, err := app.FindAllRecords(types.COL_GOAL_PLANS,
+		dbx.HashExp{"status": "active"},
+		dbx.NewExp("target_date < {:now}", dbx.Params{"now": utils.FormatDBTime(time.Now())}),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, plan := range plans {
+		plan.Set("status", "completed")
+		if err := app.Save(plan); err != nil {
+			slog.Error("Failed to complete goal plan", "planId", plan.Id, "error", err)
+		}
+	}
+
+	return nil
+}
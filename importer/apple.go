@@ -0,0 +1,217 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/workout"
+)
+
+const appleDateLayout = "2006-01-02 15:04:05 -0700"
+
+const lbToKg = 0.45359237
+
+var appleWorkoutTypes = map[string]types.ActivityType{
+	"HKWorkoutActivityTypeWalking":                     types.ACTIVITY_WALKING,
+	"HKWorkoutActivityTypeRunning":                     types.ACTIVITY_RUNNING,
+	"HKWorkoutActivityTypeCycling":                     types.ACTIVITY_CYCLING,
+	"HKWorkoutActivityTypeSwimming":                    types.ACTIVITY_SWIMMING,
+	"HKWorkoutActivityTypeHiking":                      types.ACTIVITY_HIKING,
+	"HKWorkoutActivityTypeTraditionalStrengthTraining": types.ACTIVITY_STRENGTH_TRAINING,
+	"HKWorkoutActivityTypeFunctionalStrengthTraining":  types.ACTIVITY_STRENGTH_TRAINING,
+}
+
+// isAppleExport matches export.xml but not the export_cda.xml next to it.
+func isAppleExport(name string) bool {
+	return strings.EqualFold(path.Base(name), "export.xml")
+}
+
+type appleRecord struct {
+	Type       string `xml:"type,attr"`
+	SourceName string `xml:"sourceName,attr"`
+	Unit       string `xml:"unit,attr"`
+	StartDate  string `xml:"startDate,attr"`
+	Value      string `xml:"value,attr"`
+}
+
+type appleWorkout struct {
+	ActivityType      string `xml:"workoutActivityType,attr"`
+	Duration          string `xml:"duration,attr"`
+	DurationUnit      string `xml:"durationUnit,attr"`
+	TotalDistance     string `xml:"totalDistance,attr"`
+	TotalDistanceUnit string `xml:"totalDistanceUnit,attr"`
+	StartDate         string `xml:"startDate,attr"`
+	Statistics        []struct {
+		Type    string `xml:"type,attr"`
+		Average string `xml:"average,attr"`
+		Maximum string `xml:"maximum,attr"`
+		Sum     string `xml:"sum,attr"`
+		Unit    string `xml:"unit,attr"`
+	} `xml:"WorkoutStatistics"`
+}
+
+// parseAppleHealth streams export.xml, which easily reaches gigabytes for
+// a few years of watch data.
+func parseAppleHealth(archive *zip.Reader) (healthData, error) {
+	file, err := findZipFile(archive, isAppleExport).Open()
+	if err != nil {
+		return healthData{}, err
+	}
+	defer file.Close()
+
+	var (
+		data healthData
+
+		// steps by day and source, the phone and the watch both count the
+		// same steps so only the source with the most steps is used
+		steps = map[string]map[string]int{}
+	)
+
+	decoder := xml.NewDecoder(file)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return healthData{}, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "Record":
+			var record appleRecord
+			if err := decoder.DecodeElement(&record, &start); err != nil {
+				return healthData{}, err
+			}
+
+			switch record.Type {
+			case "HKQuantityTypeIdentifierStepCount":
+				value, err := strconv.ParseFloat(record.Value, 64)
+				if err != nil || len(record.StartDate) < 10 {
+					continue
+				}
+
+				// the date part is already in the device's local time
+				day := record.StartDate[:10]
+				if steps[day] == nil {
+					steps[day] = map[string]int{}
+				}
+				steps[day][record.SourceName] += int(value)
+
+			case "HKQuantityTypeIdentifierBodyMass":
+				value, err := strconv.ParseFloat(record.Value, 64)
+				if err != nil {
+					continue
+				}
+				at, err := time.Parse(appleDateLayout, record.StartDate)
+				if err != nil {
+					continue
+				}
+				if record.Unit == "lb" {
+					value *= lbToKg
+				}
+
+				data.weights = append(data.weights, weightSample{
+					ExternalID: SOURCE_APPLE_HEALTH + ":weight:" + strconv.FormatInt(at.Unix(), 10),
+					At:         at,
+					WeightKg:   value,
+				})
+			}
+
+		case "Workout":
+			var w appleWorkout
+			if err := decoder.DecodeElement(&w, &start); err != nil {
+				return healthData{}, err
+			}
+
+			if imported, ok := w.toWorkout(); ok {
+				data.workouts = append(data.workouts, imported)
+			}
+		}
+	}
+
+	for day, bySource := range steps {
+		most := 0
+		for _, count := range bySource {
+			most = max(most, count)
+		}
+		data.steps = append(data.steps, dailySteps{Day: day, Steps: most})
+	}
+	sort.Slice(data.steps, func(i, j int) bool { return data.steps[i].Day < data.steps[j].Day })
+
+	return data, nil
+}
+
+func (w appleWorkout) toWorkout() (importedWorkout, bool) {
+	startedAt, err := time.Parse(appleDateLayout, w.StartDate)
+	if err != nil {
+		return importedWorkout{}, false
+	}
+
+	duration, _ := strconv.ParseFloat(w.Duration, 64)
+	switch w.DurationUnit {
+	case "", "min":
+		duration *= 60
+	case "h", "hr":
+		duration *= 3600
+	}
+
+	result := workout.Workout{
+		StartedAt: startedAt,
+		Duration:  time.Duration(duration * float64(time.Second)),
+		DistanceM: appleDistanceM(w.TotalDistance, w.TotalDistanceUnit),
+	}
+
+	// newer exports moved the totals into WorkoutStatistics
+	for _, stat := range w.Statistics {
+		switch {
+		case stat.Type == "HKQuantityTypeIdentifierHeartRate":
+			result.AvgHeartRate, _ = strconv.ParseFloat(stat.Average, 64)
+			result.MaxHeartRate, _ = strconv.ParseFloat(stat.Maximum, 64)
+		case strings.HasPrefix(stat.Type, "HKQuantityTypeIdentifierDistance") && result.DistanceM == 0:
+			result.DistanceM = appleDistanceM(stat.Sum, stat.Unit)
+		}
+	}
+
+	activityType, ok := appleWorkoutTypes[w.ActivityType]
+	if !ok {
+		activityType = types.ACTIVITY_CUSTOM
+	}
+
+	return importedWorkout{
+		ExternalID: SOURCE_APPLE_HEALTH + ":workout:" + strconv.FormatInt(startedAt.Unix(), 10),
+		Type:       activityType,
+		Name:       customName(w.ActivityType),
+		Workout:    result,
+	}, true
+}
+
+func appleDistanceM(value, unit string) float64 {
+	distance, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+
+	switch unit {
+	case "km":
+		return distance * 1000
+	case "mi":
+		return distance * 1609.344
+	case "m":
+		return distance
+	}
+
+	return 0
+}
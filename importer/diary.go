@@ -0,0 +1,355 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	SOURCE_MYFITNESSPAL = "myfitnesspal"
+	SOURCE_CRONOMETER   = "cronometer"
+)
+
+var ErrUnknownDiary = errors.New("unknown diary export, expected a MyFitnessPal or Cronometer CSV")
+
+// errDryRun rolls back the transaction of a dry run once everything has
+// been counted.
+var errDryRun = errors.New("dry run")
+
+type DiaryReport struct {
+	Source  string `json:"source"`
+	DryRun  bool   `json:"dry_run"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Meals   Counts `json:"meals"`
+	Entries Counts `json:"entries"`
+}
+
+type diaryEntry struct {
+	Day    string
+	Clock  string
+	Slot   types.MealSlot
+	Name   string
+	Amount string
+	Macros types.MacroTotals
+}
+
+// slotClocks places entries exported without a time of day inside their
+// meal slot, so they keep their order on the day.
+var slotClocks = map[types.MealSlot]string{
+	types.MEAL_SLOT_BREAKFAST: "08:00",
+	types.MEAL_SLOT_LUNCH:     "12:30",
+	types.MEAL_SLOT_DINNER:    "19:00",
+	types.MEAL_SLOT_SNACK:     "15:00",
+}
+
+var clockLayouts = []string{"15:04", "15:04:05", "3:04 PM", "3:04PM", "3:04:05 PM"}
+
+// ImportDiary imports a MyFitnessPal nutrition export or a Cronometer
+// servings export. Every diary entry becomes a meal_history record pointing
+// at a completed meal template, identical foods share one template. A dry
+// run reports what would be imported without saving anything.
+func ImportDiary(app core.App, userID string, r io.Reader, dryRun bool) (DiaryReport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return DiaryReport{}, ErrUnknownDiary
+	}
+	columns := csvColumns(header)
+
+	var (
+		entries []diaryEntry
+		source  string
+	)
+
+	switch {
+	case hasColumns(columns, "Day", "Food Name", "Energy (kcal)"):
+		source = SOURCE_CRONOMETER
+		entries, err = parseCronometer(reader, columns)
+	case hasColumns(columns, "Date", "Meal", "Calories"):
+		source = SOURCE_MYFITNESSPAL
+		entries, err = parseMyFitnessPal(reader, columns)
+	default:
+		return DiaryReport{}, ErrUnknownDiary
+	}
+	if err != nil {
+		return DiaryReport{}, err
+	}
+
+	report := DiaryReport{Source: source, DryRun: dryRun}
+	err = app.RunInTransaction(func(txApp core.App) error {
+		if err := storeDiary(txApp, userID, source, entries, &report); err != nil {
+			return err
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+
+	return report, err
+}
+
+// parseMyFitnessPal reads the "Nutrition" export, which has one row per
+// meal and day rather than per food.
+func parseMyFitnessPal(reader *csv.Reader, columns map[string]int) ([]diaryEntry, error) {
+	var entries []diaryEntry
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		meal := csvString(row, columns, "Meal")
+		name := meal
+		if note := csvString(row, columns, "Note"); note != "" {
+			name = meal + ": " + note
+		}
+
+		entries = append(entries, diaryEntry{
+			Day:   csvString(row, columns, "Date"),
+			Clock: parseClock(csvString(row, columns, "Time")),
+			Slot:  mealSlotFromName(meal),
+			Name:  name,
+			Macros: types.MacroTotals{
+				Calories: csvNumber(row, columns, "Calories"),
+				ProteinG: csvNumber(row, columns, "Protein (g)"),
+				CarbsG:   csvNumber(row, columns, "Carbohydrates (g)"),
+				FatG:     csvNumber(row, columns, "Fat (g)"),
+			},
+		})
+	}
+
+	return entries, nil
+}
+
+// parseCronometer reads the "Servings" export, one row per logged food.
+func parseCronometer(reader *csv.Reader, columns map[string]int) ([]diaryEntry, error) {
+	var entries []diaryEntry
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, diaryEntry{
+			Day:    csvString(row, columns, "Day"),
+			Clock:  parseClock(csvString(row, columns, "Time")),
+			Slot:   mealSlotFromName(csvString(row, columns, "Group")),
+			Name:   csvString(row, columns, "Food Name"),
+			Amount: csvString(row, columns, "Amount"),
+			Macros: types.MacroTotals{
+				Calories: csvNumber(row, columns, "Energy (kcal)"),
+				ProteinG: csvNumber(row, columns, "Protein (g)"),
+				CarbsG:   csvNumber(row, columns, "Carbs (g)"),
+				FatG:     csvNumber(row, columns, "Fat (g)"),
+			},
+		})
+	}
+
+	return entries, nil
+}
+
+func storeDiary(app core.App, userID, source string, entries []diaryEntry, report *DiaryReport) error {
+	templates, err := app.FindCollectionByNameOrId(types.COL_MEAL_TEMPLATES)
+	if err != nil {
+		return err
+	}
+
+	history, err := app.FindCollectionByNameOrId(types.COL_MEAL_HISTORY)
+	if err != nil {
+		return err
+	}
+
+	loc := utils.UserLocation(app, userID)
+
+	var (
+		seenMeals   = map[string]bool{}
+		occurrences = map[string]int{}
+	)
+
+	for _, entry := range entries {
+		clock := entry.Clock
+		if clock == "" {
+			clock = slotClocks[entry.Slot]
+		}
+		if clock == "" {
+			clock = "12:00"
+		}
+
+		consumedAt, err := time.ParseInLocation(utils.DateLayout+" 15:04", entry.Day+" "+clock, loc)
+		if err != nil {
+			report.Entries.Skipped++
+			continue
+		}
+
+		// water, supplements and other entries without energy or macros
+		m := entry.Macros
+		if m.Calories <= 0 && m.ProteinG <= 0 && m.CarbsG <= 0 && m.FatG <= 0 {
+			report.Entries.Skipped++
+			continue
+		}
+
+		// the same food logged twice in the same slot is two entries
+		entryKey := entry.Day + "|" + entry.Clock + "|" + entry.Slot + "|" + foodKey(entry)
+		occurrences[entryKey]++
+		entryID := fmt.Sprintf("%s:entry:%s:%s:%d", source, entry.Day, shortHash(entryKey), occurrences[entryKey])
+
+		if findByExternalID(app, types.COL_MEAL_HISTORY, userID, entryID) != nil {
+			report.Entries.Skipped++
+			continue
+		}
+
+		mealID := source + ":meal:" + shortHash(foodKey(entry))
+		meal := findByExternalID(app, types.COL_MEAL_TEMPLATES, userID, mealID)
+		if meal == nil {
+			meal = core.NewRecord(templates)
+			meal.Set("user", userID)
+			meal.Set("name", entry.Name)
+			meal.Set("description", entry.Amount)
+			meal.Set("processing_status", "completed")
+			meal.Set("total_calories", math.Round(m.Calories))
+			meal.Set("total_protein_g", math.Round(m.ProteinG*10)/10)
+			meal.Set("total_carbs_g", math.Round(m.CarbsG*10)/10)
+			meal.Set("total_fat_g", math.Round(m.FatG*10)/10)
+			meal.Set("meal_type", entry.Slot)
+			meal.Set("external_id", mealID)
+			if err := app.Save(meal); err != nil {
+				return err
+			}
+			report.Meals.Created++
+		} else if !seenMeals[mealID] {
+			report.Meals.Skipped++
+		}
+		seenMeals[mealID] = true
+
+		record := core.NewRecord(history)
+		record.Set("meal", meal.Id)
+		record.Set("user", userID)
+		record.Set("portion_multiplier", 1.0)
+		record.Set("consumed_at", consumedAt)
+		record.Set("meal_slot", entry.Slot)
+		record.Set("external_id", entryID)
+		if err := app.Save(record); err != nil {
+			return err
+		}
+		report.Entries.Created++
+
+		if report.From == "" || entry.Day < report.From {
+			report.From = entry.Day
+		}
+		if entry.Day > report.To {
+			report.To = entry.Day
+		}
+	}
+
+	return nil
+}
+
+// foodKey identifies a food by its name, amount and nutrition, so the same
+// food logged on many days maps to a single template.
+func foodKey(entry diaryEntry) string {
+	m := entry.Macros
+	return fmt.Sprintf("%s|%s|%.1f|%.1f|%.1f|%.1f",
+		strings.ToLower(entry.Name), strings.ToLower(entry.Amount), m.Calories, m.ProteinG, m.CarbsG, m.FatG)
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// mealSlotFromName maps diary meal names like "Breakfast" or "Snacks" to a
+// meal slot, custom meal names are left to slot inference.
+func mealSlotFromName(name string) types.MealSlot {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "breakfast":
+		return types.MEAL_SLOT_BREAKFAST
+	case "lunch":
+		return types.MEAL_SLOT_LUNCH
+	case "dinner":
+		return types.MEAL_SLOT_DINNER
+	case "snack", "snacks":
+		return types.MEAL_SLOT_SNACK
+	}
+
+	return ""
+}
+
+// parseClock normalizes an exported time of day to "15:04", empty when
+// there is none.
+func parseClock(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range clockLayouts {
+		if t, err := time.Parse(layout, strings.ToUpper(s)); err == nil {
+			return t.Format("15:04")
+		}
+	}
+
+	return ""
+}
+
+func csvColumns(header []string) map[string]int {
+	columns := map[string]int{}
+	for i, name := range header {
+		// Excel and both apps like to start the file with a byte order mark
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	return columns
+}
+
+func hasColumns(columns map[string]int, names ...string) bool {
+	for _, name := range names {
+		if _, ok := columns[name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func csvString(row []string, columns map[string]int, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+
+	return strings.TrimSpace(row[i])
+}
+
+func csvNumber(row []string, columns map[string]int, name string) float64 {
+	value, err := strconv.ParseFloat(csvString(row, columns, name), 64)
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
@@ -0,0 +1,157 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/ignoxx/caloriemate/workout"
+)
+
+func isGoogleFitFile(name string) bool {
+	return strings.Contains(name, "Fit/")
+}
+
+func isGoogleFitDailyMetrics(name string) bool {
+	return strings.Contains(name, "Fit/") && path.Base(name) == "Daily activity metrics.csv"
+}
+
+func isGoogleFitActivity(name string) bool {
+	return strings.Contains(name, "Fit/Activities/") && strings.EqualFold(path.Ext(name), ".tcx")
+}
+
+// parseGoogleFit reads the daily summary CSV for steps and weight and the
+// TCX files Takeout writes for every recorded session. Only the English
+// export column names are supported.
+func parseGoogleFit(archive *zip.Reader) (healthData, error) {
+	var data healthData
+
+	if f := findZipFile(archive, isGoogleFitDailyMetrics); f != nil {
+		if err := parseGoogleFitDailyMetrics(f, &data); err != nil {
+			return healthData{}, err
+		}
+	}
+
+	for _, f := range archive.File {
+		if !isGoogleFitActivity(f.Name) {
+			continue
+		}
+
+		raw, err := readZipFile(f)
+		if err != nil {
+			return healthData{}, err
+		}
+
+		w, err := workout.ParseTCX(raw)
+		if err != nil || w.StartedAt.IsZero() {
+			continue
+		}
+
+		activityType := w.Sport
+		if activityType == "" {
+			activityType = types.ACTIVITY_CUSTOM
+		}
+
+		// file names look like "2023-01-01T10_00_00+01_00_PT30M_Running.tcx"
+		name := strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name))
+		if i := strings.LastIndex(name, "_"); i >= 0 {
+			name = name[i+1:]
+		}
+
+		data.workouts = append(data.workouts, importedWorkout{
+			ExternalID: SOURCE_GOOGLE_FIT + ":workout:" + strconv.FormatInt(w.StartedAt.Unix(), 10),
+			Type:       activityType,
+			Name:       customName(name),
+			Workout:    w,
+		})
+	}
+
+	return data, nil
+}
+
+func parseGoogleFitDailyMetrics(f *zip.File, data *healthData) error {
+	file, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	dateColumn, ok := columns["Date"]
+	if !ok {
+		return errors.New("daily activity metrics have no Date column")
+	}
+
+	field := func(row []string, name string) (float64, bool) {
+		i, ok := columns[name]
+		if !ok || i >= len(row) || row[i] == "" {
+			return 0, false
+		}
+
+		value, err := strconv.ParseFloat(row[i], 64)
+		return value, err == nil
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if dateColumn >= len(row) {
+			continue
+		}
+
+		day := row[dateColumn]
+		if _, err := time.Parse(utils.DateLayout, day); err != nil {
+			continue
+		}
+
+		if steps, ok := field(row, "Step count"); ok {
+			data.steps = append(data.steps, dailySteps{Day: day, Steps: int(steps)})
+		}
+
+		// only a daily average is exported, it is placed on the day like the steps
+		if weight, ok := field(row, "Average weight (kg)"); ok {
+			data.weights = append(data.weights, weightSample{
+				ExternalID: SOURCE_GOOGLE_FIT + ":weight:" + day,
+				Day:        day,
+				WeightKg:   weight,
+			})
+		}
+	}
+
+	return nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	file, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
@@ -0,0 +1,279 @@
+// Package importer brings data exported from other apps into the user's
+// collections. Every imported record carries an external_id so importing
+// the same export again updates or skips instead of duplicating.
+package importer
+
+import (
+	"archive/zip"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/ignoxx/caloriemate/workout"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	SOURCE_APPLE_HEALTH = "apple_health"
+	SOURCE_GOOGLE_FIT   = "google_fit"
+
+	// defaultCustomMET is used for workouts of types we have no MET for
+	defaultCustomMET = 5.0
+)
+
+var ErrUnknownArchive = errors.New("unknown export, expected an Apple Health or Google Takeout zip")
+
+type Counts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+type Report struct {
+	Source   string `json:"source"`
+	Steps    Counts `json:"steps"`
+	Weights  Counts `json:"weights"`
+	Workouts Counts `json:"workouts"`
+}
+
+type dailySteps struct {
+	Day   string
+	Steps int
+}
+
+// weightSample is a weigh-in at At, or a daily value with only its Day,
+// which is placed in the user's timezone on import.
+type weightSample struct {
+	ExternalID string
+	At         time.Time
+	Day        string
+	WeightKg   float64
+}
+
+type importedWorkout struct {
+	ExternalID string
+	Type       types.ActivityType
+	Name       string
+	Workout    workout.Workout
+}
+
+type healthData struct {
+	steps    []dailySteps
+	weights  []weightSample
+	workouts []importedWorkout
+}
+
+// ImportHealthArchive imports an Apple Health or Google Takeout export zip
+// for the user.
+func ImportHealthArchive(app core.App, userID, path string) (Report, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return Report{}, err
+	}
+	defer archive.Close()
+
+	var (
+		data   healthData
+		source string
+	)
+
+	switch {
+	case findZipFile(&archive.Reader, isAppleExport) != nil:
+		source = SOURCE_APPLE_HEALTH
+		data, err = parseAppleHealth(&archive.Reader)
+	case findZipFile(&archive.Reader, isGoogleFitFile) != nil:
+		source = SOURCE_GOOGLE_FIT
+		data, err = parseGoogleFit(&archive.Reader)
+	default:
+		return Report{}, ErrUnknownArchive
+	}
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Source: source}
+	err = app.RunInTransaction(func(txApp core.App) error {
+		return storeHealthData(txApp, userID, source, data, &report)
+	})
+
+	return report, err
+}
+
+func findZipFile(archive *zip.Reader, match func(name string) bool) *zip.File {
+	for _, f := range archive.File {
+		if match(f.Name) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// NewWorkoutActivity builds an activity log from a parsed workout. The
+// calories are left to the activity_logs record hook.
+func NewWorkoutActivity(collection *core.Collection, userID string, activityType types.ActivityType, w workout.Workout) *core.Record {
+	startedAt := w.StartedAt
+	if startedAt.IsZero() {
+		startedAt = time.Now()
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("user", userID)
+	record.Set("activity_type", activityType)
+	record.Set("started_at", startedAt)
+	record.Set("duration_minutes", math.Round(w.Duration.Minutes()))
+	record.Set("distance_km", math.Round(w.DistanceM/10)/100)
+	record.Set("elevation_gain_m", math.Round(w.ElevationGainM))
+	record.Set("avg_heart_rate", w.AvgHeartRate)
+	record.Set("max_heart_rate", w.MaxHeartRate)
+
+	return record
+}
+
+func findByExternalID(app core.App, collection types.Collection, userID, externalID string) *core.Record {
+	record, err := app.FindFirstRecordByFilter(collection, "user = {:user} && external_id = {:externalId}", dbx.Params{
+		"user":       userID,
+		"externalId": externalID,
+	})
+	if err != nil {
+		return nil
+	}
+
+	return record
+}
+
+func storeHealthData(app core.App, userID, source string, data healthData, report *Report) error {
+	activities, err := app.FindCollectionByNameOrId(types.COL_ACTIVITY_LOGS)
+	if err != nil {
+		return err
+	}
+
+	weights, err := app.FindCollectionByNameOrId(types.COL_WEIGHT_LOGS)
+	if err != nil {
+		return err
+	}
+
+	loc := utils.UserLocation(app, userID)
+
+	for _, day := range data.steps {
+		if day.Steps <= 0 {
+			continue
+		}
+
+		externalID := source + ":steps:" + day.Day
+
+		// the export's last day is usually partial, so totals may grow
+		if record := findByExternalID(app, types.COL_ACTIVITY_LOGS, userID, externalID); record != nil {
+			if record.GetInt("steps") == day.Steps {
+				report.Steps.Skipped++
+				continue
+			}
+
+			record.Set("steps", day.Steps)
+			if err := app.Save(record); err != nil {
+				return err
+			}
+			report.Steps.Updated++
+			continue
+		}
+
+		date, err := time.ParseInLocation(utils.DateLayout, day.Day, loc)
+		if err != nil {
+			report.Steps.Skipped++
+			continue
+		}
+
+		record := core.NewRecord(activities)
+		record.Set("user", userID)
+		record.Set("activity_type", types.ACTIVITY_WALKING)
+		record.Set("steps", day.Steps)
+		// daily totals have no time, noon keeps them on the right day
+		record.Set("started_at", date.Add(12*time.Hour))
+		record.Set("external_id", externalID)
+		if err := app.Save(record); err != nil {
+			return err
+		}
+		report.Steps.Created++
+	}
+
+	for _, sample := range data.weights {
+		// out of the range weight_logs accepts, most likely a unit mixup
+		if sample.WeightKg < 20 || sample.WeightKg > 500 {
+			report.Weights.Skipped++
+			continue
+		}
+
+		if findByExternalID(app, types.COL_WEIGHT_LOGS, userID, sample.ExternalID) != nil {
+			report.Weights.Skipped++
+			continue
+		}
+
+		measuredAt := sample.At
+		if sample.Day != "" {
+			date, err := time.ParseInLocation(utils.DateLayout, sample.Day, loc)
+			if err != nil {
+				report.Weights.Skipped++
+				continue
+			}
+			// like the steps, noon keeps a daily value on the right day
+			measuredAt = date.Add(12 * time.Hour)
+		}
+
+		record := core.NewRecord(weights)
+		record.Set("user", userID)
+		record.Set("weight_kg", math.Round(sample.WeightKg*100)/100)
+		record.Set("measured_at", measuredAt)
+		record.Set("external_id", sample.ExternalID)
+		if err := app.Save(record); err != nil {
+			return err
+		}
+		report.Weights.Created++
+	}
+
+	for _, imported := range data.workouts {
+		if imported.Workout.Duration <= 0 {
+			report.Workouts.Skipped++
+			continue
+		}
+
+		if findByExternalID(app, types.COL_ACTIVITY_LOGS, userID, imported.ExternalID) != nil {
+			report.Workouts.Skipped++
+			continue
+		}
+
+		activityType := imported.Type
+		record := NewWorkoutActivity(activities, userID, activityType, imported.Workout)
+		if activityType == types.ACTIVITY_CUSTOM {
+			record.Set("custom_name", imported.Name)
+			record.Set("met", defaultCustomMET)
+		}
+		record.Set("external_id", imported.ExternalID)
+		if err := app.Save(record); err != nil {
+			return err
+		}
+		report.Workouts.Created++
+	}
+
+	return nil
+}
+
+// customName turns identifiers like "HKWorkoutActivityTypeMixedCardio" or
+// "mixed_cardio" into a readable name.
+func customName(name string) string {
+	name = strings.TrimPrefix(name, "HKWorkoutActivityType")
+	name = strings.ReplaceAll(name, "_", " ")
+
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' && name[i-1] != ' ' {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+	}
+
+	return strings.TrimSpace(b.String())
+}
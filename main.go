@@ -8,6 +8,9 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"slices"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/joho/godotenv"
 	"github.com/mattn/go-sqlite3"
@@ -23,9 +26,12 @@ import (
 	"github.com/ignoxx/caloriemate/ai/clip"
 	"github.com/ignoxx/caloriemate/ai/ollama"
 	"github.com/ignoxx/caloriemate/ai/openrouter"
+	"github.com/ignoxx/caloriemate/ai/phash"
 	"github.com/ignoxx/caloriemate/api"
 	_ "github.com/ignoxx/caloriemate/migrations"
+	"github.com/ignoxx/caloriemate/nutrition"
 	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
 )
 
 func init() {
@@ -107,18 +113,72 @@ func main() {
 		log.Fatalf("Unknown AI_PROVIDER: %s (valid options: ollama, openrouter)", aiProvider)
 	}
 
-	var imgLlm ai.Embedder = clip.New()
+	embedder := os.Getenv("EMBEDDER")
+
+	var imgLlm ai.Embedder
+	switch embedder {
+	case "", "clip":
+		client, err := clip.New()
+		switch {
+		case err == nil:
+			imgLlm = client
+			app.Logger().Info("Using CLIP embedder")
+		case embedder == "":
+			// without the CLIP service the app still works, with rougher matching
+			imgLlm = phash.New()
+			app.Logger().Warn("CLIP_HOST not set, using built-in perceptual hash embedder")
+		default:
+			log.Fatalf("EMBEDDER=clip: %v", err)
+		}
+	case "phash":
+		imgLlm = phash.New()
+		app.Logger().Info("Using built-in perceptual hash embedder")
+	default:
+		log.Fatalf("Unknown EMBEDDER: %s (valid options: clip, phash)", embedder)
+	}
+
+	dedup := loadDedupConfig()
+	searchMargin := floatFromEnv("SEARCH_IMAGE_MARGIN", api.DefaultImageSearchMargin)
+
+	registerCommands(app, imgLlm)
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		if err := adoptVectorSet(se.App, imgLlm); err != nil {
+			slog.Error("Failed to check meal vector set", "error", err)
+		}
+
+		return se.Next()
+	})
 
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
 		// serves static FE files
 		se.Router.GET("/{path...}", apis.Static(distDirFs, true))
 
+		// onboarding previews targets before the account exists
+		se.Router.POST("/api/v1/targets/preview", api.HandlePostTargetsPreview)
+
 		cr := se.Router.Group("/api/v1")
 		cr.Bind(apis.RequireAuth())
 
 		cr.GET("/similar/{id}", api.HandleGetSimilarMealTemplates)
+		cr.GET("/search", api.HandleGetMealSearch(imgLlm, searchMargin))
 		cr.POST("/meal/{id}/link/{targetId}", api.HandlePostMealLink)
 		cr.POST("/meal/{id}/hide", api.HandlePostMealHide)
+		cr.POST("/meal/{id}/suggestion/confirm", api.HandlePostMealSuggestionConfirm)
+		cr.POST("/meal/{id}/suggestion/reject", api.HandlePostMealSuggestionReject)
+		cr.GET("/summary/day", api.HandleGetDaySummary)
+		cr.GET("/summary/range", api.HandleGetRangeSummary)
+		cr.GET("/weight/trend", api.HandleGetWeightTrend)
+		cr.GET("/tdee/adaptive", api.HandleGetAdaptiveTDEE)
+		cr.POST("/tdee/proposals/{id}/accept", api.HandlePostTDEEProposalAccept)
+		cr.POST("/tdee/proposals/{id}/reject", api.HandlePostTDEEProposalReject)
+		cr.GET("/goal/progress", api.HandleGetGoalProgress)
+		cr.GET("/export", api.HandleGetExport)
+		cr.GET("/account/export", api.HandleGetAccountExport)
+		cr.DELETE("/account", api.HandleDeleteAccount)
+		cr.POST("/activity/import", api.HandlePostActivityImport)
+		cr.POST("/import/health", api.HandlePostHealthImport).Bind(apis.BodyLimit(maxImportSize))
+		cr.POST("/import/diary", api.HandlePostDiaryImport)
 
 		return se.Next()
 	})
@@ -142,12 +202,214 @@ func main() {
 		return e.Next()
 	})
 
+	// weekly, so each proposal covers mostly new days
+	app.Cron().MustAdd("adaptiveTargets", "0 4 * * 1", func() {
+		api.ProposeAdaptiveTargets(app)
+	})
+
+	app.Cron().MustAdd("completeGoalPlans", "0 3 * * *", func() {
+		if err := completeExpiredGoalPlans(app); err != nil {
+			slog.Error("Failed to complete expired goal plans", "error", err)
+		}
+	})
+
+	app.OnRecordCreate(types.COL_MEAL_HISTORY).BindFunc(func(e *core.RecordEvent) error {
+		// entries created without an explicit time count as eaten now
+		if e.Record.GetDateTime("consumed_at").IsZero() {
+			e.Record.Set("consumed_at", time.Now())
+		}
+
+		if e.Record.GetString("meal_slot") == "" {
+			assignMealSlot(e.App, e.Record)
+		}
+
+		// a double tap or a retried request logs the same meal again
+		if duplicate := findDuplicateEntry(e.App, e.Record, dedup.EntryWindow); duplicate != nil {
+			return apis.NewBadRequestError("This meal is already logged at this time", nil)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordUpdate(types.COL_MEAL_HISTORY).BindFunc(func(e *core.RecordEvent) error {
+		original := e.Record.Original()
+
+		// re-infer on backdating unless the slot was picked explicitly
+		consumedAtChanged := !original.GetDateTime("consumed_at").Equal(e.Record.GetDateTime("consumed_at"))
+		slotChanged := original.GetString("meal_slot") != e.Record.GetString("meal_slot")
+		if consumedAtChanged && !slotChanged {
+			assignMealSlot(e.App, e.Record)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordCreate(types.COL_USER_PROFILES).BindFunc(func(e *core.RecordEvent) error {
+		applyNutritionTargets(e.App, e.Record)
+		return e.Next()
+	})
+
+	app.OnRecordUpdate(types.COL_USER_PROFILES).BindFunc(func(e *core.RecordEvent) error {
+		applyNutritionTargets(e.App, e.Record)
+		return e.Next()
+	})
+
+	app.OnRecordCreate(types.COL_ACTIVITY_LOGS).BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetDateTime("started_at").IsZero() {
+			e.Record.Set("started_at", time.Now())
+		}
+
+		if err := applyActivityCalories(e.App, e.Record); err != nil {
+			return err
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordUpdate(types.COL_ACTIVITY_LOGS).BindFunc(func(e *core.RecordEvent) error {
+		// other edits keep the calories computed with the weight back then
+		if !activityInputsChanged(e.Record) {
+			e.Record.Set("calories_burned", e.Record.Original().GetFloat("calories_burned"))
+			return e.Next()
+		}
+
+		if err := applyActivityCalories(e.App, e.Record); err != nil {
+			return err
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordCreate(types.COL_WEIGHT_LOGS).BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetDateTime("measured_at").IsZero() {
+			e.Record.Set("measured_at", time.Now())
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordAfterCreateSuccess(types.COL_WEIGHT_LOGS).BindFunc(func(e *core.RecordEvent) error {
+		if err := syncProfileWeight(e.App, e.Record.GetString("user")); err != nil {
+			slog.Error("Failed to sync profile weight", "error", err)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess(types.COL_WEIGHT_LOGS).BindFunc(func(e *core.RecordEvent) error {
+		if err := syncProfileWeight(e.App, e.Record.GetString("user")); err != nil {
+			slog.Error("Failed to sync profile weight", "error", err)
+		}
+
+		// a log moved to another user changes the previous owner's latest weigh-in too
+		if owner := e.Record.Original().GetString("user"); owner != e.Record.GetString("user") {
+			if err := syncProfileWeight(e.App, owner); err != nil {
+				slog.Error("Failed to sync profile weight", "error", err)
+			}
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess(types.COL_WEIGHT_LOGS).BindFunc(func(e *core.RecordEvent) error {
+		if err := syncProfileWeight(e.App, e.Record.GetString("user")); err != nil {
+			slog.Error("Failed to sync profile weight", "error", err)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordCreate(types.COL_GOAL_PLANS).BindFunc(func(e *core.RecordEvent) error {
+		if err := prepareGoalPlan(e.App, e.Record); err != nil {
+			return err
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordUpdate(types.COL_GOAL_PLANS).BindFunc(func(e *core.RecordEvent) error {
+		if err := prepareGoalPlan(e.App, e.Record); err != nil {
+			return err
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordAfterCreateSuccess(types.COL_GOAL_PLANS).BindFunc(func(e *core.RecordEvent) error {
+		if err := activateGoalPlan(e.App, e.Record); err != nil {
+			slog.Error("Failed to apply goal plan", "error", err)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess(types.COL_GOAL_PLANS).BindFunc(func(e *core.RecordEvent) error {
+		if err := activateGoalPlan(e.App, e.Record); err != nil {
+			slog.Error("Failed to apply goal plan", "error", err)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess(types.COL_GOAL_PLANS).BindFunc(func(e *core.RecordEvent) error {
+		// the targets may still carry the deleted plan's delta
+		if err := refreshGoalTargets(e.App, e.Record.GetString("user")); err != nil {
+			slog.Error("Failed to refresh targets after goal plan delete", "error", err)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordValidate(types.COL_USER_PROFILES).BindFunc(func(e *core.RecordEvent) error {
+		var windows types.MealSlotWindows
+		if err := e.Record.UnmarshalJSONField("meal_slot_windows", &windows); err != nil {
+			return apis.NewBadRequestError("Invalid meal slot windows", err)
+		}
+
+		if err := utils.ValidateMealSlotWindows(windows); err != nil {
+			return apis.NewBadRequestError("Invalid meal slot windows", err)
+		}
+
+		if tz := e.Record.GetString("timezone"); tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil {
+				return apis.NewBadRequestError("Invalid timezone", err)
+			}
+		}
+
+		schedule, err := nutrition.TargetScheduleFromRecord(e.Record)
+		if err != nil {
+			return apis.NewBadRequestError("Invalid target schedule", err)
+		}
+
+		base := types.MacroTotals{
+			Calories: e.Record.GetFloat("target_calories"),
+			ProteinG: e.Record.GetFloat("target_protein_g"),
+			CarbsG:   e.Record.GetFloat("target_carbs_g"),
+			FatG:     e.Record.GetFloat("target_fat_g"),
+		}
+		if err := nutrition.ValidateTargetSchedule(schedule, base); err != nil {
+			return apis.NewBadRequestError("Invalid target schedule: "+err.Error(), err)
+		}
+
+		return e.Next()
+	})
+
 	app.OnRecordAfterCreateSuccess(types.COL_MEAL_TEMPLATES).BindFunc(func(e *core.RecordEvent) error {
-		if err := processMealTemplate(e.App, e.Record, llm, imgLlm); err != nil {
+		// imported diary entries come with their nutrition and history
+		if e.Record.GetString("processing_status") == "completed" {
 			return e.Next()
 		}
 
-		if err := createMealHistory(e.App, e.Record); err != nil {
+		if cached := findCachedAnalysis(e.App, e.Record, dedup.AnalysisWindow); cached != nil {
+			slog.Info("Reusing analysis of identical upload", "recordId", e.Record.Id, "cachedId", cached.Id)
+			if err := reuseCachedAnalysis(e.App, e.Record, cached); err != nil {
+				return e.Next()
+			}
+		} else if err := processMealTemplate(e.App, e.Record, llm, imgLlm); err != nil {
+			return e.Next()
+		}
+
+		if err := createMealHistory(e.App, e.Record, dedup.EntryWindow); err != nil {
 			slog.Error("Failed to create meal_history", "error", err)
 		}
 
@@ -163,6 +425,61 @@ func main() {
 			if err := processMealTemplate(e.App, e.Record, llm, imgLlm); err != nil {
 				return e.Next()
 			}
+
+			return e.Next()
+		}
+
+		// a replaced photo would otherwise keep matching by the old one
+		if !slices.Equal(e.Record.Original().GetStringSlice("image"), e.Record.GetStringSlice("image")) {
+			slog.Info("Meal template image changed, refreshing vector", "recordId", e.Record.Id)
+			if err := refreshMealVector(e.App, e.Record, imgLlm); err != nil {
+				slog.Error("Failed to refresh meal vector", "recordId", e.Record.Id, "error", err)
+			}
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess(types.COL_MEAL_TEMPLATES).BindFunc(func(e *core.RecordEvent) error {
+		if err := deleteMealVector(e.App, e.Record.Id); err != nil {
+			slog.Error("Failed to delete meal vector", "recordId", e.Record.Id, "error", err)
+		}
+
+		deleteMealText(e.App, e.Record.Id)
+
+		return e.Next()
+	})
+
+	app.OnRecordCreate(types.COL_MEAL_TEMPLATES).BindFunc(func(e *core.RecordEvent) error {
+		if err := setImageHash(e.Record); err != nil {
+			slog.Error("Failed to hash meal image", "error", err)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordUpdate(types.COL_MEAL_TEMPLATES).BindFunc(func(e *core.RecordEvent) error {
+		if err := setImageHash(e.Record); err != nil {
+			slog.Error("Failed to hash meal image", "recordId", e.Record.Id, "error", err)
+		}
+
+		return e.Next()
+	})
+
+	// kept apart from the analysis hooks above, which return early
+	app.OnRecordAfterCreateSuccess(types.COL_MEAL_TEMPLATES).BindFunc(func(e *core.RecordEvent) error {
+		// duplicate uploads are deleted again by the analysis hooks
+		if _, err := e.App.FindRecordById(types.COL_MEAL_TEMPLATES, e.Record.Id); err != nil {
+			return e.Next()
+		}
+
+		indexMealText(e.App, e.Record)
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess(types.COL_MEAL_TEMPLATES).BindFunc(func(e *core.RecordEvent) error {
+		if mealTextChanged(e.Record) {
+			indexMealText(e.App, e.Record)
 		}
 
 		return e.Next()
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func loadMealSlotWindows(app core.App, userID string) types.MealSlotWindows {
+	profile, err := app.FindFirstRecordByData(types.COL_USER_PROFILES, "user", userID)
+	if err != nil {
+		return types.DefaultMealSlotWindows
+	}
+
+	var custom types.MealSlotWindows
+	if err := profile.UnmarshalJSONField("meal_slot_windows", &custom); err != nil {
+		return types.DefaultMealSlotWindows
+	}
+
+	return utils.MergeMealSlotWindows(custom)
+}
+
+// assignMealSlot infers the meal slot of a meal_history record from its
+// consumed time, using the meal template's dish type to break ties.
+func assignMealSlot(app core.App, record *core.Record) {
+	var guess string
+	if mealID := record.GetString("meal"); mealID != "" {
+		if meal, err := app.FindRecordById(types.COL_MEAL_TEMPLATES, mealID); err == nil {
+			guess = meal.GetString("meal_type")
+		}
+	}
+
+	consumedAt := record.GetDateTime("consumed_at").Time().In(utils.UserLocation(app, record.GetString("user")))
+	windows := loadMealSlotWindows(app, record.GetString("user"))
+
+	slot := utils.InferMealSlot(consumedAt, windows, guess)
+	record.Set("meal_slot", slot)
+
+	slog.Info("Assigned meal slot", "recordId", record.Id, "slot", slot, "guess", guess)
+}
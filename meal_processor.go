@@ -4,10 +4,14 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"slices"
+	"time"
 
 	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
 	"github.com/ignoxx/caloriemate/ai"
+	"github.com/ignoxx/caloriemate/api"
 	"github.com/ignoxx/caloriemate/types"
+	"github.com/ignoxx/caloriemate/utils"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 )
@@ -28,34 +32,56 @@ func getImageReader(app core.App, record *core.Record) (io.ReadSeekCloser, error
 	return fsys.GetReader(path)
 }
 
-func generateMealEmbedding(app core.App, record *core.Record, imgLlm ai.Embedder) ([]byte, error) {
+// mealEmbedding is an image vector together with the model that made it.
+type mealEmbedding struct {
+	Model  ai.EmbeddingModel
+	Vector []byte
+}
+
+func generateMealEmbedding(app core.App, record *core.Record, imgLlm ai.Embedder) (mealEmbedding, error) {
+	model, err := imgLlm.Model()
+	if err != nil {
+		slog.Error("Failed to get embedding model", "error", err)
+		return mealEmbedding{}, err
+	}
+
 	imageFile, err := getImageReader(app, record)
 	if err != nil {
 		slog.Error("Failed to open meal template image", "error", err)
-		return nil, err
+		return mealEmbedding{}, err
 	}
 	defer imageFile.Close()
 
 	rawEmbedding, err := imgLlm.GenerateEmbeddings(imageFile)
 	if err != nil {
 		slog.Error("Failed to generate image embedding", "error", err)
-		return nil, err
+		return mealEmbedding{}, err
 	}
 
 	mealVector, err := sqlite_vec.SerializeFloat32(rawEmbedding)
 	if err != nil {
 		slog.Error("Failed to serialize embedding", "error", err)
-		return nil, err
+		return mealEmbedding{}, err
 	}
 
-	return mealVector, nil
+	return mealEmbedding{Model: model, Vector: mealVector}, nil
 }
 
-func findSimilarMealIDs(app core.App, mealVector []byte, recordId string) ([]mealMatch, error) {
+// findSimilarMealIDs searches the nearest meals among the ones of the
+// template's owner, other users' meals are never candidates. While the
+// active vectors come from another model there are no matches.
+func findSimilarMealIDs(app core.App, embedding mealEmbedding, record *core.Record) ([]mealMatch, error) {
+	set, err := api.FindVectorSetForModel(app, embedding.Model)
+	if err != nil {
+		slog.Warn("Skipping similar meal search", "recordId", record.Id, "error", err)
+		return nil, nil
+	}
+
 	var matches []mealMatch
 
-	err := app.DB().NewQuery("SELECT meal_template_id, distance FROM meal_image_vectors WHERE embedding MATCH {:mealVector} AND k = 5;").Bind(dbx.Params{
-		"mealVector": mealVector,
+	err = app.DB().NewQuery("SELECT meal_template_id, distance FROM {{" + set.Name + "}} WHERE embedding MATCH {:mealVector} AND k = 5 AND user_id = {:userId};").Bind(dbx.Params{
+		"mealVector": embedding.Vector,
+		"userId":     record.GetString("user"),
 	}).All(&matches)
 
 	if err != nil {
@@ -63,59 +89,70 @@ func findSimilarMealIDs(app core.App, mealVector []byte, recordId string) ([]mea
 		return nil, err
 	}
 
-	slog.Info("Found similar meals", "count", len(matches), "recordId", recordId)
+	slog.Info("Found similar meals", "count", len(matches), "recordId", record.Id)
 	return matches, nil
 }
 
-func analyzeMealTemplate(app core.App, record *core.Record, llm ai.Analyzer, similarMeals []mealMatch) error {
-	shouldAnalyze := true
+// loadAutoMatchPolicy returns the user's auto-match mode and the distance
+// below which an earlier meal counts as a match.
+func loadAutoMatchPolicy(app core.App, userID string) (types.AutoMatchMode, float64) {
+	profile, err := app.FindFirstRecordByData(types.COL_USER_PROFILES, "user", userID)
+	if err != nil {
+		return types.AUTO_MATCH_AUTO, types.DefaultAutoMatchDistance
+	}
+
+	mode := profile.GetString("auto_match_mode")
+	if mode == "" {
+		mode = types.AUTO_MATCH_AUTO
+	}
 
-	if len(similarMeals) > 0 {
-		var bestMatch mealMatch
-		for _, match := range similarMeals {
-			if match.MealTemplateID != record.Id {
-				bestMatch = match
-				break
+	maxDistance := profile.GetFloat("auto_match_distance")
+	if maxDistance <= 0 {
+		maxDistance = types.DefaultAutoMatchDistance
+	}
+
+	return mode, maxDistance
+}
+
+func analyzeMealTemplate(app core.App, record *core.Record, llm ai.Analyzer, similarMeals []mealMatch) error {
+	mode, maxDistance := loadAutoMatchPolicy(app, record.GetString("user"))
+
+	var (
+		match         *core.Record
+		matchDistance float32
+	)
+
+	if mode != types.AUTO_MATCH_OFF {
+		// matches are ordered by distance, only the nearest other meal counts
+		for _, similar := range similarMeals {
+			if similar.MealTemplateID == record.Id {
+				continue
 			}
-		}
 
-		if bestMatch.Distance < 0.1 && bestMatch.MealTemplateID != record.Id {
-			slog.Info("Auto-matching with existing meal", "recordId", record.Id, "matchId", bestMatch.MealTemplateID, "distance", bestMatch.Distance)
-
-			similarRecord, err := app.FindRecordById(types.COL_MEAL_TEMPLATES, bestMatch.MealTemplateID)
-			if err == nil {
-				record.Set("name", similarRecord.GetString("name"))
-				record.Set("ai_description", similarRecord.GetString("ai_description"))
-				record.Set("total_calories", similarRecord.GetInt("total_calories"))
-				record.Set("calorie_uncertainty_percent", similarRecord.GetInt("calorie_uncertainty_percent"))
-				record.Set("total_protein_g", similarRecord.GetInt("total_protein_g"))
-				record.Set("protein_uncertainty_percent", similarRecord.GetInt("protein_uncertainty_percent"))
-				record.Set("total_carbs_g", similarRecord.GetInt("total_carbs_g"))
-				record.Set("carbs_uncertainty_percent", similarRecord.GetInt("carbs_uncertainty_percent"))
-				record.Set("total_fat_g", similarRecord.GetInt("total_fat_g"))
-				record.Set("fat_uncertainty_percent", similarRecord.GetInt("fat_uncertainty_percent"))
-				record.Set("processing_status", "completed")
-
-				if similarRecord.GetString("linked_meal_template_id") != "" {
-					record.Set("linked_meal_template_id", similarRecord.GetString("linked_meal_template_id"))
-				} else if similarRecord.GetBool("is_primary_in_group") {
-					record.Set("linked_meal_template_id", bestMatch.MealTemplateID)
-				} else {
-					similarRecord.Set("is_primary_in_group", true)
-					if err := app.Save(similarRecord); err != nil {
-						slog.Error("Failed to make similar meal primary", "error", err)
-					} else {
-						record.Set("linked_meal_template_id", bestMatch.MealTemplateID)
-						slog.Info("Auto-linked new meal to similar meal", "newMeal", record.Id, "primaryMeal", bestMatch.MealTemplateID)
-					}
+			if float64(similar.Distance) < maxDistance {
+				if similarRecord, err := app.FindRecordById(types.COL_MEAL_TEMPLATES, similar.MealTemplateID); err == nil {
+					match, matchDistance = similarRecord, similar.Distance
 				}
-
-				shouldAnalyze = false
-				slog.Info("Auto-match completed", "recordId", record.Id, "matchId", bestMatch.MealTemplateID)
 			}
+			break
 		}
 	}
 
+	// a re-analysis starts without the previous suggestion
+	record.Set("suggested_meal_template_id", "")
+	record.Set("suggested_match_distance", 0)
+
+	shouldAnalyze := true
+
+	if match != nil && mode == types.AUTO_MATCH_AUTO {
+		slog.Info("Auto-matching with existing meal", "recordId", record.Id, "matchId", match.Id, "distance", matchDistance)
+
+		api.ApplyMealMatch(app, record, match)
+
+		shouldAnalyze = false
+		slog.Info("Auto-match completed", "recordId", record.Id, "matchId", match.Id)
+	}
+
 	if shouldAnalyze {
 		imageFile, err := getImageReader(app, record)
 		if err != nil {
@@ -140,7 +177,16 @@ func analyzeMealTemplate(app core.App, record *core.Record, llm ai.Analyzer, sim
 		record.Set("carbs_uncertainty_percent", meal.CarbsUncertaintyPercent)
 		record.Set("total_fat_g", meal.TotalFatG)
 		record.Set("fat_uncertainty_percent", meal.FatUncertaintyPercent)
+		if slices.Contains(types.MealSlots, meal.MealType) {
+			record.Set("meal_type", meal.MealType)
+		}
 		record.Set("processing_status", "completed")
+
+		if match != nil {
+			record.Set("suggested_meal_template_id", match.Id)
+			record.Set("suggested_match_distance", matchDistance)
+			slog.Info("Suggesting match with existing meal", "recordId", record.Id, "matchId", match.Id, "distance", matchDistance)
+		}
 	}
 
 	if err := app.Save(record); err != nil {
@@ -151,33 +197,53 @@ func analyzeMealTemplate(app core.App, record *core.Record, llm ai.Analyzer, sim
 	return nil
 }
 
-func upsertMealVector(app core.App, recordId string, mealVector []byte) error {
-	_, _ = app.DB().NewQuery("DELETE FROM meal_image_vectors WHERE meal_template_id = {:id}").Bind(dbx.Params{
-		"id": recordId,
-	}).Execute()
-
-	_, err := app.DB().NewQuery("INSERT INTO meal_image_vectors(meal_template_id, embedding) VALUES ({:meal_template_id}, {:embedding})").Bind(dbx.Params{
-		"meal_template_id": recordId,
-		"embedding":        mealVector,
-	}).Execute()
-
+// upsertMealVector stores the vector in every set made by its model, which
+// during a reindex includes the set being built.
+func upsertMealVector(app core.App, record *core.Record, embedding mealEmbedding) error {
+	sets, err := api.FindVectorSets(app)
 	if err != nil {
-		slog.Error("Failed to save meal vector", "error", err)
 		return err
 	}
 
+	stored := false
+	for _, set := range sets {
+		if set.Model != embedding.Model.Name || set.Dimensions != embedding.Model.Dimensions {
+			continue
+		}
+
+		_, _ = app.DB().NewQuery("DELETE FROM {{" + set.Name + "}} WHERE meal_template_id = {:id}").Bind(dbx.Params{
+			"id": record.Id,
+		}).Execute()
+
+		_, err := app.DB().NewQuery("INSERT INTO {{" + set.Name + "}}(user_id, meal_template_id, embedding) VALUES ({:user_id}, {:meal_template_id}, {:embedding})").Bind(dbx.Params{
+			"user_id":          record.GetString("user"),
+			"meal_template_id": record.Id,
+			"embedding":        embedding.Vector,
+		}).Execute()
+
+		if err != nil {
+			slog.Error("Failed to save meal vector", "error", err)
+			return err
+		}
+		stored = true
+	}
+
+	if !stored {
+		slog.Warn("No vector set for embedding model, run vectors reindex", "recordId", record.Id, "model", embedding.Model.Name)
+	}
+
 	return nil
 }
 
 func processMealTemplate(app core.App, record *core.Record, llm ai.Analyzer, imgLlm ai.Embedder) error {
 	slog.Info("Starting meal template analysis", "recordId", record.Id)
 
-	mealVector, err := generateMealEmbedding(app, record, imgLlm)
+	embedding, err := generateMealEmbedding(app, record, imgLlm)
 	if err != nil {
 		return err
 	}
 
-	similarMeals, err := findSimilarMealIDs(app, mealVector, record.Id)
+	similarMeals, err := findSimilarMealIDs(app, embedding, record)
 	if err != nil {
 		return err
 	}
@@ -186,7 +252,7 @@ func processMealTemplate(app core.App, record *core.Record, llm ai.Analyzer, img
 		return err
 	}
 
-	if err := upsertMealVector(app, record.Id, mealVector); err != nil {
+	if err := upsertMealVector(app, record, embedding); err != nil {
 		return err
 	}
 
@@ -194,7 +260,35 @@ func processMealTemplate(app core.App, record *core.Record, llm ai.Analyzer, img
 	return nil
 }
 
-func createMealHistory(app core.App, record *core.Record) error {
+// mealConsumedAt prefers the time the photo was taken over the upload time,
+// so meals uploaded later still count for when they were eaten.
+func mealConsumedAt(app core.App, record *core.Record) time.Time {
+	uploadedAt := record.GetDateTime("created").Time()
+
+	imageFile, err := getImageReader(app, record)
+	if err != nil {
+		return uploadedAt
+	}
+	defer imageFile.Close()
+
+	takenAt, err := utils.ExifDateTimeOriginal(imageFile, utils.UserLocation(app, record.GetString("user")))
+	if err != nil {
+		slog.Info("No EXIF capture time, using upload time", "recordId", record.Id, "reason", err)
+		return uploadedAt
+	}
+
+	// a capture time after the upload means a misconfigured camera clock
+	if takenAt.After(uploadedAt) {
+		return uploadedAt
+	}
+
+	return takenAt
+}
+
+// createMealHistory logs the analyzed meal. When the same photo was logged
+// moments ago by an identical upload, the new template is removed instead so
+// the library doesn't keep a meal that was never eaten.
+func createMealHistory(app core.App, record *core.Record, entryWindow time.Duration) error {
 	mealHistoryCollection, err := app.FindCollectionByNameOrId("meal_history")
 	if err != nil {
 		slog.Error("Failed to find meal_history collection", "error", err)
@@ -205,6 +299,23 @@ func createMealHistory(app core.App, record *core.Record) error {
 	mealHistoryRecord.Set("meal", record.Id)
 	mealHistoryRecord.Set("user", record.GetString("user"))
 	mealHistoryRecord.Set("portion_multiplier", 1.0)
+	mealHistoryRecord.Set("consumed_at", mealConsumedAt(app, record))
+
+	if duplicate := findDuplicateEntry(app, mealHistoryRecord, entryWindow); duplicate != nil {
+		slog.Info("Skipping duplicate meal_history record", "mealTemplateId", record.Id, "mealHistoryId", duplicate.Id)
+
+		if duplicate.GetString("meal") == record.Id {
+			return nil
+		}
+
+		// the delete hooks drop its copied vector and search index row
+		if err := app.Delete(record); err != nil {
+			slog.Error("Failed to delete duplicate meal template", "recordId", record.Id, "error", err)
+			return err
+		}
+
+		return nil
+	}
 
 	if err := app.Save(mealHistoryRecord); err != nil {
 		slog.Error("Failed to auto-create meal_history record", "error", err)
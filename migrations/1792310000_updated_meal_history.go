@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_160532052")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(9, []byte(`{
+			"hidden": false,
+			"id": "date1401683402",
+			"max": "",
+			"min": "",
+			"name": "consumed_at",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		collection.AddIndex("idx_meal_history_user_consumed_at", false, "`user`, `consumed_at`", "")
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// existing entries were logged at upload time
+		_, err = app.DB().NewQuery("UPDATE meal_history SET consumed_at = created WHERE consumed_at = ''").Execute()
+		return err
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_160532052")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("date1401683402")
+		collection.RemoveIndex("idx_meal_history_user_consumed_at")
+
+		return app.Save(collection)
+	})
+}
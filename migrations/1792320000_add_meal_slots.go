@@ -0,0 +1,173 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	pbtypes "github.com/pocketbase/pocketbase/tools/types"
+)
+
+// backfillMealSlotWindows is a frozen copy of the default windows at the time
+// of this migration, in minutes of the day, so later changes to the defaults
+// don't change what the backfill did.
+var backfillMealSlotWindows = []struct {
+	slot       string
+	start, end int
+}{
+	{"breakfast", 5 * 60, 10*60 + 30},
+	{"lunch", 11 * 60, 14*60 + 30},
+	{"dinner", 17*60 + 30, 21*60 + 30},
+}
+
+// backfillMealSlot buckets a minute of the day into the first matching
+// window, anything outside of them is a snack.
+func backfillMealSlot(minute int) string {
+	for _, window := range backfillMealSlotWindows {
+		if minute >= window.start && minute < window.end {
+			return window.slot
+		}
+	}
+
+	return "snack"
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+		history, err := app.FindCollectionByNameOrId("pbc_160532052")
+		if err != nil {
+			return err
+		}
+
+		// Add meal_slot field, inferred from consumed_at when not set
+		if err := history.Fields.AddMarshaledJSONAt(10, []byte(`{
+			"hidden": false,
+			"id": "select1797327931",
+			"maxSelect": 1,
+			"name": "meal_slot",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"breakfast",
+				"lunch",
+				"dinner",
+				"snack"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(history); err != nil {
+			return err
+		}
+
+		templates, err := app.FindCollectionByNameOrId("pbc_4138469906")
+		if err != nil {
+			return err
+		}
+
+		// Add meal_type field, the dish type guessed by the model
+		if err := templates.Fields.AddMarshaledJSONAt(15, []byte(`{
+			"hidden": false,
+			"id": "select2363381545",
+			"maxSelect": 1,
+			"name": "meal_type",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"breakfast",
+				"lunch",
+				"dinner",
+				"snack"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(templates); err != nil {
+			return err
+		}
+
+		profiles, err := app.FindCollectionByNameOrId("pbc_2190040129")
+		if err != nil {
+			return err
+		}
+
+		// Add meal_slot_windows field, overrides for the default slot windows
+		if err := profiles.Fields.AddMarshaledJSONAt(13, []byte(`{
+			"hidden": false,
+			"id": "json1950258397",
+			"maxSize": 0,
+			"name": "meal_slot_windows",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "json"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(profiles); err != nil {
+			return err
+		}
+
+		// Backfill existing entries using the default windows. Profiles have
+		// no timezone yet, so times are bucketed in UTC.
+		var rows []struct {
+			ID         string `db:"id"`
+			ConsumedAt string `db:"consumed_at"`
+		}
+		if err := app.DB().Select("id", "consumed_at").From("meal_history").All(&rows); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			consumedAt, err := pbtypes.ParseDateTime(row.ConsumedAt)
+			if err != nil || consumedAt.IsZero() {
+				continue
+			}
+
+			t := consumedAt.Time().UTC()
+			slot := backfillMealSlot(t.Hour()*60 + t.Minute())
+			if _, err := app.DB().Update("meal_history", dbx.Params{"meal_slot": slot}, dbx.HashExp{"id": row.ID}).Execute(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		history, err := app.FindCollectionByNameOrId("pbc_160532052")
+		if err != nil {
+			return err
+		}
+
+		history.Fields.RemoveById("select1797327931")
+
+		if err := app.Save(history); err != nil {
+			return err
+		}
+
+		templates, err := app.FindCollectionByNameOrId("pbc_4138469906")
+		if err != nil {
+			return err
+		}
+
+		templates.Fields.RemoveById("select2363381545")
+
+		if err := app.Save(templates); err != nil {
+			return err
+		}
+
+		profiles, err := app.FindCollectionByNameOrId("pbc_2190040129")
+		if err != nil {
+			return err
+		}
+
+		profiles.Fields.RemoveById("json1950258397")
+
+		return app.Save(profiles)
+	})
+}
@@ -0,0 +1,116 @@
+package migrations
+
+import (
+	"math"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2190040129")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(13, []byte(`{
+			"hidden": false,
+			"id": "bool2768406745",
+			"name": "custom_targets",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "bool"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// targets the old client formula produced are recomputed server-side
+		// from now on, anything else was entered by the user and is kept
+		profiles, err := app.FindAllRecords("user_profiles", dbx.NewExp("target_calories > 0"))
+		if err != nil {
+			return err
+		}
+
+		customIDs := []any{}
+		for _, profile := range profiles {
+			if !legacyTargetsMatch(profile) {
+				customIDs = append(customIDs, profile.Id)
+			}
+		}
+
+		if len(customIDs) == 0 {
+			return nil
+		}
+
+		_, err = app.DB().Update("user_profiles", dbx.Params{"custom_targets": true}, dbx.HashExp{"id": customIDs}).Execute()
+		return err
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2190040129")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("bool2768406745")
+
+		return app.Save(collection)
+	})
+}
+
+// legacyActivityMultipliers and the formula below are a frozen copy of what
+// the frontend used before targets moved to the server.
+var legacyActivityMultipliers = map[string]float64{
+	"sedentary":   1.2,
+	"light":       1.375,
+	"moderate":    1.55,
+	"active":      1.725,
+	"very active": 1.9,
+}
+
+// legacyTargetsMatch reports whether the stored targets are what one of the
+// old client-side calculations produced. Some of them ignored gender or
+// treated gain_muscle as maintain, so every variant counts as a match.
+func legacyTargetsMatch(profile *core.Record) bool {
+	weight := profile.GetFloat("weight_kg")
+	height := profile.GetFloat("height_cm")
+	age := float64(profile.GetInt("age"))
+
+	multiplier, ok := legacyActivityMultipliers[profile.GetString("activity_level")]
+	if !ok || weight <= 0 || height <= 0 || age <= 0 {
+		return false
+	}
+
+	if math.Abs(profile.GetFloat("target_protein_g")-math.Round(weight*1.8)) > 1 {
+		return false
+	}
+
+	adjustments := []float64{0}
+	switch profile.GetString("goal") {
+	case "lose_weight":
+		adjustments = []float64{-500}
+	case "gain_weight":
+		adjustments = []float64{500}
+	case "gain_muscle":
+		adjustments = []float64{0, 500}
+	}
+
+	calories := profile.GetFloat("target_calories")
+	base := 10*weight + 6.25*height - 5*age
+	for _, sexOffset := range []float64{5, -161} {
+		for _, adjustment := range adjustments {
+			if math.Abs(calories-math.Round((base+sexOffset)*multiplier+adjustment)) <= 1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
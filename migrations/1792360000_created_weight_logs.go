@@ -0,0 +1,127 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": "@request.auth.id != \"\" && @request.body.user = @request.auth.id",
+			"deleteRule": "@request.auth.id = user.id",
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "_pb_users_auth_",
+					"hidden": false,
+					"id": "relation2375276105",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "user",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"hidden": false,
+					"id": "number2654930660",
+					"max": 500,
+					"min": 20,
+					"name": "weight_kg",
+					"onlyInt": false,
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "date2282468447",
+					"max": "",
+					"min": "",
+					"name": "measured_at",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text18589324",
+					"max": 500,
+					"min": 0,
+					"name": "note",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_3265417218",
+			"indexes": [
+				"CREATE INDEX ` + "`" + `idx_weight_logs_user_measured_at` + "`" + ` ON ` + "`" + `weight_logs` + "`" + ` (` + "`" + `user` + "`" + `, ` + "`" + `measured_at` + "`" + `)"
+			],
+			"listRule": "@request.auth.id = user.id",
+			"name": "weight_logs",
+			"system": false,
+			"type": "base",
+			"updateRule": "@request.auth.id = user.id && (@request.body.user:isset = false || @request.body.user = @request.auth.id)",
+			"viewRule": "@request.auth.id = user.id"
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3265417218")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,117 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_444539071")
+		if err != nil {
+			return err
+		}
+
+		// add fields
+		fields := []string{`{
+			"hidden": false,
+			"id": "date1960470564",
+			"max": "",
+			"min": "",
+			"name": "started_at",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`, `{
+			"hidden": false,
+			"id": "number2713985513",
+			"max": null,
+			"min": 0,
+			"name": "distance_km",
+			"onlyInt": false,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`, `{
+			"hidden": false,
+			"id": "number1290147052",
+			"max": null,
+			"min": 0,
+			"name": "elevation_gain_m",
+			"onlyInt": false,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`, `{
+			"hidden": false,
+			"id": "number3406437213",
+			"max": 250,
+			"min": 0,
+			"name": "avg_heart_rate",
+			"onlyInt": false,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`, `{
+			"hidden": false,
+			"id": "number4197830651",
+			"max": 250,
+			"min": 0,
+			"name": "max_heart_rate",
+			"onlyInt": false,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`, `{
+			"hidden": false,
+			"id": "file1372950254",
+			"maxSelect": 1,
+			"maxSize": 20971520,
+			"mimeTypes": [],
+			"name": "source_file",
+			"presentable": false,
+			"protected": true,
+			"required": false,
+			"system": false,
+			"thumbs": [],
+			"type": "file"
+		}`}
+
+		for i, field := range fields {
+			if err := collection.Fields.AddMarshaledJSONAt(7+i, []byte(field)); err != nil {
+				return err
+			}
+		}
+
+		collection.AddIndex("idx_activity_logs_user_started_at", false, "`user`, `started_at`", "")
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// manual entries were logged when they happened
+		_, err = app.DB().NewQuery("UPDATE activity_logs SET started_at = created WHERE started_at = ''").Execute()
+		return err
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_444539071")
+		if err != nil {
+			return err
+		}
+
+		// remove fields
+		collection.Fields.RemoveById("date1960470564")
+		collection.Fields.RemoveById("number2713985513")
+		collection.Fields.RemoveById("number1290147052")
+		collection.Fields.RemoveById("number3406437213")
+		collection.Fields.RemoveById("number4197830651")
+		collection.Fields.RemoveById("file1372950254")
+		collection.RemoveIndex("idx_activity_logs_user_started_at")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,87 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		activities, err := app.FindCollectionByNameOrId("pbc_444539071")
+		if err != nil {
+			return err
+		}
+
+		// Add external_id field, set by importers to dedupe re-imports
+		if err := activities.Fields.AddMarshaledJSONAt(13, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1953401412",
+			"max": 255,
+			"min": 0,
+			"name": "external_id",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		activities.AddIndex("idx_activity_logs_user_external_id", true, "`user`, `external_id`", "`external_id` != ''")
+
+		if err := app.Save(activities); err != nil {
+			return err
+		}
+
+		weights, err := app.FindCollectionByNameOrId("pbc_3265417218")
+		if err != nil {
+			return err
+		}
+
+		if err := weights.Fields.AddMarshaledJSONAt(5, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1953401412",
+			"max": 255,
+			"min": 0,
+			"name": "external_id",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		weights.AddIndex("idx_weight_logs_user_external_id", true, "`user`, `external_id`", "`external_id` != ''")
+
+		return app.Save(weights)
+	}, func(app core.App) error {
+		activities, err := app.FindCollectionByNameOrId("pbc_444539071")
+		if err != nil {
+			return err
+		}
+
+		activities.Fields.RemoveById("text1953401412")
+		activities.RemoveIndex("idx_activity_logs_user_external_id")
+
+		if err := app.Save(activities); err != nil {
+			return err
+		}
+
+		weights, err := app.FindCollectionByNameOrId("pbc_3265417218")
+		if err != nil {
+			return err
+		}
+
+		weights.Fields.RemoveById("text1953401412")
+		weights.RemoveIndex("idx_weight_logs_user_external_id")
+
+		return app.Save(weights)
+	})
+}
@@ -0,0 +1,87 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		templates, err := app.FindCollectionByNameOrId("pbc_4138469906")
+		if err != nil {
+			return err
+		}
+
+		// Add external_id field, set by the diary importers to dedupe re-imports
+		if err := templates.Fields.AddMarshaledJSONAt(18, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1953401412",
+			"max": 255,
+			"min": 0,
+			"name": "external_id",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		templates.AddIndex("idx_meal_templates_user_external_id", true, "`user`, `external_id`", "`external_id` != ''")
+
+		if err := app.Save(templates); err != nil {
+			return err
+		}
+
+		history, err := app.FindCollectionByNameOrId("pbc_160532052")
+		if err != nil {
+			return err
+		}
+
+		if err := history.Fields.AddMarshaledJSONAt(12, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1953401412",
+			"max": 255,
+			"min": 0,
+			"name": "external_id",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		history.AddIndex("idx_meal_history_user_external_id", true, "`user`, `external_id`", "`external_id` != ''")
+
+		return app.Save(history)
+	}, func(app core.App) error {
+		templates, err := app.FindCollectionByNameOrId("pbc_4138469906")
+		if err != nil {
+			return err
+		}
+
+		templates.Fields.RemoveById("text1953401412")
+		templates.RemoveIndex("idx_meal_templates_user_external_id")
+
+		if err := app.Save(templates); err != nil {
+			return err
+		}
+
+		history, err := app.FindCollectionByNameOrId("pbc_160532052")
+		if err != nil {
+			return err
+		}
+
+		history.Fields.RemoveById("text1953401412")
+		history.RemoveIndex("idx_meal_history_user_external_id")
+
+		return app.Save(history)
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// vec0 tables can't be renamed, so the vectors are copied out to a plain
+// table while the virtual table is recreated.
+func rebuildMealVectors(app core.App, create, backfill string) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		queries := []string{
+			`CREATE TABLE _meal_image_vectors_backup AS
+				SELECT v.meal_template_id, t.user AS user_id, v.embedding
+				FROM meal_image_vectors v
+				JOIN meal_templates t ON t.id = v.meal_template_id`,
+			`DROP TABLE meal_image_vectors`,
+			create,
+			backfill,
+			`DROP TABLE _meal_image_vectors_backup`,
+		}
+
+		for _, query := range queries {
+			if _, err := txApp.DB().NewQuery(query).Execute(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Partition the image vectors by owner so KNN queries only ever see
+		// the user's own meals. Vectors of deleted templates are dropped.
+		return rebuildMealVectors(app, `
+			CREATE VIRTUAL TABLE meal_image_vectors USING vec0(
+				user_id TEXT PARTITION KEY,
+				meal_template_id TEXT,
+				embedding float[512]
+			)`, `
+			INSERT INTO meal_image_vectors(user_id, meal_template_id, embedding)
+				SELECT user_id, meal_template_id, embedding FROM _meal_image_vectors_backup`)
+	}, func(app core.App) error {
+		return rebuildMealVectors(app, `
+			CREATE VIRTUAL TABLE meal_image_vectors USING vec0(
+				meal_template_id TEXT,
+				embedding float[512]
+			)`, `
+			INSERT INTO meal_image_vectors(meal_template_id, embedding)
+				SELECT meal_template_id, embedding FROM _meal_image_vectors_backup`)
+	})
+}
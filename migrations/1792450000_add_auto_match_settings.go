@@ -0,0 +1,115 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		profiles, err := app.FindCollectionByNameOrId("pbc_2190040129")
+		if err != nil {
+			return err
+		}
+
+		// Add auto_match_mode field, empty means auto
+		if err := profiles.Fields.AddMarshaledJSONAt(17, []byte(`{
+			"hidden": false,
+			"id": "select1024935887",
+			"maxSelect": 1,
+			"name": "auto_match_mode",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"auto",
+				"suggest",
+				"off"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		// Add auto_match_distance field, 0 uses the default threshold
+		if err := profiles.Fields.AddMarshaledJSONAt(18, []byte(`{
+			"hidden": false,
+			"id": "number2497463519",
+			"max": 1,
+			"min": 0,
+			"name": "auto_match_distance",
+			"onlyInt": false,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(profiles); err != nil {
+			return err
+		}
+
+		templates, err := app.FindCollectionByNameOrId("pbc_4138469906")
+		if err != nil {
+			return err
+		}
+
+		// Add the match suggested in suggest mode, cleared on confirm or reject
+		if err := templates.Fields.AddMarshaledJSONAt(19, []byte(`{
+			"cascadeDelete": false,
+			"collectionId": "pbc_4138469906",
+			"hidden": false,
+			"id": "relation3862254717",
+			"maxSelect": 1,
+			"minSelect": 0,
+			"name": "suggested_meal_template_id",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "relation"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := templates.Fields.AddMarshaledJSONAt(20, []byte(`{
+			"hidden": false,
+			"id": "number1375290348",
+			"max": null,
+			"min": 0,
+			"name": "suggested_match_distance",
+			"onlyInt": false,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(templates)
+	}, func(app core.App) error {
+		profiles, err := app.FindCollectionByNameOrId("pbc_2190040129")
+		if err != nil {
+			return err
+		}
+
+		profiles.Fields.RemoveById("select1024935887")
+		profiles.Fields.RemoveById("number2497463519")
+
+		if err := app.Save(profiles); err != nil {
+			return err
+		}
+
+		templates, err := app.FindCollectionByNameOrId("pbc_4138469906")
+		if err != nil {
+			return err
+		}
+
+		templates.Fields.RemoveById("relation3862254717")
+		templates.Fields.RemoveById("number1375290348")
+
+		return app.Save(templates)
+	})
+}
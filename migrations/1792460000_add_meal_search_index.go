@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Keyword index over the meal texts, kept in sync by the record
+		// hooks. Needs sqlite built with the sqlite_fts5 tag.
+		return app.RunInTransaction(func(txApp core.App) error {
+			queries := []string{
+				`CREATE VIRTUAL TABLE meal_templates_fts USING fts5(
+					meal_template_id UNINDEXED,
+					user_id UNINDEXED,
+					name,
+					description,
+					ai_description,
+					tokenize = 'unicode61 remove_diacritics 2'
+				)`,
+				`INSERT INTO meal_templates_fts(meal_template_id, user_id, name, description, ai_description)
+					SELECT id, user, name, description, ai_description FROM meal_templates`,
+			}
+
+			for _, query := range queries {
+				if _, err := txApp.DB().NewQuery(query).Execute(); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}, func(app core.App) error {
+		_, err := app.DB().NewQuery("DROP TABLE IF EXISTS meal_templates_fts").Execute()
+		return err
+	})
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Records which model made the vectors of each vec0 table. All
+		// existing vectors come from the CLIP service's ViT-B/32.
+		return app.RunInTransaction(func(txApp core.App) error {
+			queries := []string{
+				`CREATE TABLE meal_vector_sets (
+					name       TEXT PRIMARY KEY NOT NULL,
+					model      TEXT NOT NULL,
+					dimensions INTEGER NOT NULL,
+					status     TEXT NOT NULL,
+					created    TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%fZ'))
+				)`,
+				`CREATE UNIQUE INDEX idx_meal_vector_sets_active ON meal_vector_sets (status) WHERE status = 'active'`,
+				`INSERT INTO meal_vector_sets(name, model, dimensions, status)
+					VALUES ('meal_image_vectors', 'clip/ViT-B/32', 512, 'active')`,
+			}
+
+			for _, query := range queries {
+				if _, err := txApp.DB().NewQuery(query).Execute(); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}, func(app core.App) error {
+		_, err := app.DB().NewQuery("DROP TABLE IF EXISTS meal_vector_sets").Execute()
+		return err
+	})
+}
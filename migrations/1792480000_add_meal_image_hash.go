@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		templates, err := app.FindCollectionByNameOrId("pbc_4138469906")
+		if err != nil {
+			return err
+		}
+
+		// Add image_hash field, the SHA-256 of the uploaded photo used to
+		// spot repeated uploads. Set on upload, existing meals stay empty.
+		if err := templates.Fields.AddMarshaledJSONAt(21, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text2830127654",
+			"max": 64,
+			"min": 0,
+			"name": "image_hash",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		templates.AddIndex("idx_meal_templates_user_image_hash", false, "`user`, `image_hash`", "`image_hash` != ''")
+
+		return app.Save(templates)
+	}, func(app core.App) error {
+		templates, err := app.FindCollectionByNameOrId("pbc_4138469906")
+		if err != nil {
+			return err
+		}
+
+		templates.RemoveIndex("idx_meal_templates_user_image_hash")
+		templates.Fields.RemoveById("text2830127654")
+
+		return app.Save(templates)
+	})
+}
@@ -0,0 +1,113 @@
+package nutrition
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ignoxx/caloriemate/types"
+)
+
+const (
+	// StrideMeters is an average walking stride
+	StrideMeters = 0.7
+
+	// ConservativeFactor discounts burn estimates, which tend to run high
+	// and would otherwise inflate the calorie budget
+	ConservativeFactor = 0.8
+)
+
+// METs from the Compendium of Physical Activities, picked for a moderate
+// effort of each activity.
+var METs = map[types.ActivityType]float64{
+	types.ACTIVITY_WALKING:           3.5,
+	types.ACTIVITY_RUNNING:           9.8,
+	types.ACTIVITY_CYCLING:           7.5,
+	types.ACTIVITY_SWIMMING:          7.0,
+	types.ACTIVITY_STRENGTH_TRAINING: 5.0,
+	types.ACTIVITY_HIKING:            6.0,
+}
+
+// stepTypes can be logged by step count instead of duration.
+var stepTypes = map[types.ActivityType]bool{
+	types.ACTIVITY_WALKING: true,
+	types.ACTIVITY_RUNNING: true,
+	types.ACTIVITY_HIKING:  true,
+}
+
+var ErrNoActivityAmount = errors.New("steps or duration is required")
+
+// Activity is what the burn estimate is computed from. MET is only used for
+// custom activities, the other types use the METs table.
+type Activity struct {
+	Type            types.ActivityType
+	MET             float64
+	Steps           int
+	DurationMinutes float64
+	AvgHeartRate    float64
+}
+
+// ActivityMET returns the MET used for the activity.
+func ActivityMET(a Activity) (float64, error) {
+	if a.Type == types.ACTIVITY_CUSTOM {
+		if a.MET <= 0 {
+			return 0, errors.New("custom activities need a MET value")
+		}
+		return a.MET, nil
+	}
+
+	met, ok := METs[a.Type]
+	if !ok {
+		return 0, fmt.Errorf("unknown activity type %q", a.Type)
+	}
+
+	return met, nil
+}
+
+// CaloriesFromSteps estimates the burn of walking the given steps, using
+// roughly 0.7 kcal per kg of body weight and km.
+func CaloriesFromSteps(steps int, weightKg float64) float64 {
+	distanceKm := float64(steps) * StrideMeters / 1000
+	return math.Round(distanceKm * weightKg * 0.7 * ConservativeFactor)
+}
+
+// CaloriesFromDuration estimates the burn of an activity at the given MET.
+func CaloriesFromDuration(met float64, durationMinutes float64, weightKg float64) float64 {
+	perMinute := met * 3.5 * weightKg / 200
+	return math.Round(perMinute * durationMinutes * ConservativeFactor)
+}
+
+// CaloriesFromHeartRate uses the Keytel et al. (2005) equations, which
+// need the user's age and weight next to the average heart rate.
+func CaloriesFromHeartRate(avgHeartRate, durationMinutes float64, p Profile) float64 {
+	age := float64(p.Age)
+	male := -55.0969 + 0.6309*avgHeartRate + 0.1988*p.WeightKg + 0.2017*age
+	female := -20.4022 + 0.4472*avgHeartRate - 0.1263*p.WeightKg + 0.074*age
+
+	perMinute := bySex(p.Gender, male, female) / 4.184
+	return math.Max(0, math.Round(perMinute*durationMinutes))
+}
+
+// ActivityCalories estimates the calories burned by the activity. Heart
+// rate is the most personal signal and wins when the profile has an age.
+// Otherwise step counts are preferred for walking, other activities use the
+// duration when both are given.
+func ActivityCalories(a Activity, p Profile) (float64, error) {
+	met, err := ActivityMET(a)
+	if err != nil {
+		return 0, err
+	}
+
+	useSteps := a.Steps > 0 && stepTypes[a.Type] && (a.Type == types.ACTIVITY_WALKING || a.DurationMinutes == 0)
+
+	switch {
+	case a.AvgHeartRate > 0 && a.DurationMinutes > 0 && p.Age > 0:
+		return CaloriesFromHeartRate(a.AvgHeartRate, a.DurationMinutes, p), nil
+	case useSteps:
+		return CaloriesFromSteps(a.Steps, p.WeightKg), nil
+	case a.DurationMinutes > 0:
+		return CaloriesFromDuration(met, a.DurationMinutes, p.WeightKg), nil
+	}
+
+	return 0, ErrNoActivityAmount
+}
@@ -0,0 +1,23 @@
+package nutrition
+
+import "math"
+
+// KcalPerKg is the approximate energy content of a kg of body weight change.
+const KcalPerKg = 7700
+
+// AdaptiveTDEE back-computes maintenance calories from the average intake
+// over a period and the change of the weight trend during that period.
+func AdaptiveTDEE(averageIntake, trendStartKg, trendEndKg, days float64) float64 {
+	if days <= 0 {
+		return averageIntake
+	}
+
+	dailyBalance := (trendEndKg - trendStartKg) * KcalPerKg / days
+	return averageIntake - dailyBalance
+}
+
+// RoundCalories rounds a calorie target to the nearest 10 kcal, finer
+// precision suggests more accuracy than the estimates have.
+func RoundCalories(calories float64) float64 {
+	return math.Round(calories/10) * 10
+}
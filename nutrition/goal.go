@@ -0,0 +1,128 @@
+package nutrition
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// MaxLossPercentPerWeek is the fastest loss considered safe, faster
+	// plans are refused.
+	MaxLossPercentPerWeek = 1.0
+
+	// MaxGainPercentPerWeek is the fastest gain that is still mostly lean
+	// mass, faster plans are allowed with a warning.
+	MaxGainPercentPerWeek = 0.5
+)
+
+var ErrUnsafeRate = errors.New("unsafe rate of weight change")
+
+type GoalPlan struct {
+	StartDate      time.Time
+	StartWeightKg  float64
+	TargetDate     time.Time
+	TargetWeightKg float64
+}
+
+func GoalPlanFromRecord(record *core.Record) GoalPlan {
+	return GoalPlan{
+		StartDate:      record.GetDateTime("start_date").Time(),
+		StartWeightKg:  record.GetFloat("start_weight_kg"),
+		TargetDate:     record.GetDateTime("target_date").Time(),
+		TargetWeightKg: record.GetFloat("target_weight_kg"),
+	}
+}
+
+// FindActiveGoalPlan returns the user's active goal plan record.
+func FindActiveGoalPlan(app core.App, userID string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter(types.COL_GOAL_PLANS, "user = {:user} && status = 'active'", map[string]any{"user": userID})
+}
+
+// GoalAdjustmentFor returns the daily calorie adjustment of the user's
+// active goal plan, or the fixed one for their goal when there is none or
+// its target date has passed.
+func GoalAdjustmentFor(app core.App, userID, goal string) float64 {
+	plan, err := FindActiveGoalPlan(app, userID)
+	if err != nil || plan.GetDateTime("target_date").Time().Before(time.Now()) {
+		return GoalAdjustment(goal)
+	}
+
+	return plan.GetFloat("daily_calorie_delta")
+}
+
+func (g GoalPlan) weeks() float64 {
+	return g.TargetDate.Sub(g.StartDate).Hours() / 24 / 7
+}
+
+// WeeklyRate returns the required weight change in kg per week, negative
+// for weight loss.
+func (g GoalPlan) WeeklyRate() float64 {
+	weeks := g.weeks()
+	if weeks <= 0 {
+		return 0
+	}
+
+	return (g.TargetWeightKg - g.StartWeightKg) / weeks
+}
+
+// DailyCalorieDelta returns the daily surplus or deficit that produces the
+// required weekly rate.
+func (g GoalPlan) DailyCalorieDelta() float64 {
+	return g.WeeklyRate() * KcalPerKg / 7
+}
+
+// ProjectedWeight returns where the plan expects the weight to be at t,
+// assuming a constant rate.
+func (g GoalPlan) ProjectedWeight(t time.Time) float64 {
+	if !t.After(g.StartDate) {
+		return g.StartWeightKg
+	}
+	if !t.Before(g.TargetDate) {
+		return g.TargetWeightKg
+	}
+
+	elapsed := t.Sub(g.StartDate).Hours() / 24 / 7
+	return g.StartWeightKg + g.WeeklyRate()*elapsed
+}
+
+// Check refuses plans that end before they start or lose weight faster than
+// MaxLossPercentPerWeek, and returns a warning for fast gains.
+func (g GoalPlan) Check() (string, error) {
+	if g.weeks() <= 0 {
+		return "", errors.New("target date must be after the start date")
+	}
+	if g.StartWeightKg <= 0 || g.TargetWeightKg <= 0 {
+		return "", errors.New("start and target weight are required")
+	}
+
+	percent := g.WeeklyRate() / g.StartWeightKg * 100
+	if percent < -MaxLossPercentPerWeek {
+		return "", fmt.Errorf("%w: losing %.2f%% of body weight per week, at most %.1f%% is allowed, pick a later target date",
+			ErrUnsafeRate, -percent, MaxLossPercentPerWeek)
+	}
+	if percent > MaxGainPercentPerWeek {
+		return fmt.Sprintf("gaining %.2f%% of body weight per week, above %.1f%% most of the gain will be fat",
+			percent, MaxGainPercentPerWeek), nil
+	}
+
+	return "", nil
+}
+
+// WeeksAtRate returns how many weeks the remaining change takes at the
+// given weekly rate, or -1 when the rate moves away from the target.
+func WeeksAtRate(currentKg, targetKg, weeklyRate float64) float64 {
+	remaining := targetKg - currentKg
+	if remaining == 0 {
+		return 0
+	}
+	if weeklyRate == 0 || math.Signbit(remaining) != math.Signbit(weeklyRate) {
+		return -1
+	}
+
+	return remaining / weeklyRate
+}
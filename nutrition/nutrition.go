@@ -0,0 +1,175 @@
+package nutrition
+
+import (
+	"math"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// ProteinPerKg is the daily protein target per kg of body weight, the
+	// middle of the 1.6-2.2g range recommended for active adults.
+	ProteinPerKg = 1.8
+
+	// FatCaloriesShare is the share of the calorie target taken by fat, the
+	// rest of the non-protein energy goes to carbs.
+	FatCaloriesShare = 0.25
+
+	KcalPerGramProtein = 4
+	KcalPerGramCarbs   = 4
+	KcalPerGramFat     = 9
+)
+
+const (
+	FORMULA_MIFFLIN_ST_JEOR = "mifflin_st_jeor"
+	FORMULA_KATCH_MCARDLE   = "katch_mcardle"
+	FORMULA_HARRIS_BENEDICT = "harris_benedict"
+)
+
+// GENDER_NEUTRAL is for users who don't fit the male/female select. The
+// sex-specific equations use the midpoint of their male and female variants.
+const (
+	GENDER_MALE    = "male"
+	GENDER_FEMALE  = "female"
+	GENDER_NEUTRAL = "neutral"
+)
+
+var activityMultipliers = map[string]float64{
+	"sedentary":   1.2,
+	"light":       1.375,
+	"moderate":    1.55,
+	"active":      1.725,
+	"very active": 1.9,
+}
+
+var goalAdjustments = map[string]float64{
+	"lose_weight": -500,
+	"maintain":    0,
+	"gain_weight": 500,
+	"gain_muscle": 500,
+}
+
+type Profile struct {
+	Age           int
+	WeightKg      float64
+	HeightCm      float64
+	Gender        string
+	ActivityLevel string
+	Goal          string
+
+	// BodyFatPercent is optional and only used by Katch-McArdle.
+	BodyFatPercent float64
+	Formula        string
+}
+
+func ProfileFromRecord(record *core.Record) Profile {
+	return Profile{
+		Age:           record.GetInt("age"),
+		WeightKg:      record.GetFloat("weight_kg"),
+		HeightCm:      record.GetFloat("height_cm"),
+		Gender:        record.GetString("gender"),
+		ActivityLevel: record.GetString("activity_level"),
+		Goal:          record.GetString("goal"),
+
+		BodyFatPercent: record.GetFloat("body_fat_percent"),
+		Formula:        record.GetString("bmr_formula"),
+	}
+}
+
+// Complete reports whether the profile has everything needed for a BMR.
+func (p Profile) Complete() bool {
+	return p.Age > 0 && p.WeightKg > 0 && p.HeightCm > 0
+}
+
+// BMR returns the basal metabolic rate using the profile's formula.
+// Katch-McArdle needs a body fat percentage and falls back to Mifflin-St Jeor
+// without one.
+func BMR(p Profile) float64 {
+	switch p.Formula {
+	case FORMULA_KATCH_MCARDLE:
+		if p.BodyFatPercent > 0 && p.BodyFatPercent < 100 {
+			return KatchMcArdle(p)
+		}
+	case FORMULA_HARRIS_BENEDICT:
+		return HarrisBenedict(p)
+	}
+
+	return MifflinStJeor(p)
+}
+
+func MifflinStJeor(p Profile) float64 {
+	base := 10*p.WeightKg + 6.25*p.HeightCm - 5*float64(p.Age)
+	return base + bySex(p.Gender, 5, -161)
+}
+
+// HarrisBenedict uses the Roza and Shizgal (1984) revision.
+func HarrisBenedict(p Profile) float64 {
+	male := 88.362 + 13.397*p.WeightKg + 4.799*p.HeightCm - 5.677*float64(p.Age)
+	female := 447.593 + 9.247*p.WeightKg + 3.098*p.HeightCm - 4.330*float64(p.Age)
+	return bySex(p.Gender, male, female)
+}
+
+// KatchMcArdle is based on lean body mass only, which suits lean and
+// muscular users that the weight based formulas underestimate.
+func KatchMcArdle(p Profile) float64 {
+	leanMassKg := p.WeightKg * (1 - p.BodyFatPercent/100)
+	return 370 + 21.6*leanMassKg
+}
+
+func bySex(gender string, male, female float64) float64 {
+	switch gender {
+	case GENDER_MALE:
+		return male
+	case GENDER_FEMALE:
+		return female
+	default:
+		return (male + female) / 2
+	}
+}
+
+// ActivityMultiplier returns the TDEE factor for an activity level,
+// defaulting to sedentary for unknown levels.
+func ActivityMultiplier(level string) float64 {
+	if multiplier, ok := activityMultipliers[level]; ok {
+		return multiplier
+	}
+
+	return activityMultipliers["sedentary"]
+}
+
+// GoalAdjustment returns the daily calorie surplus or deficit for a goal.
+func GoalAdjustment(goal string) float64 {
+	return goalAdjustments[goal]
+}
+
+// TDEE returns the total daily energy expenditure.
+func TDEE(p Profile) float64 {
+	return BMR(p) * ActivityMultiplier(p.ActivityLevel)
+}
+
+// Targets returns the daily calorie and macro targets for a profile.
+func Targets(p Profile) types.MacroTotals {
+	return TargetsWithAdjustment(p, GoalAdjustment(p.Goal))
+}
+
+// TargetsWithAdjustment is like Targets with an explicit daily surplus or
+// deficit, e.g. the one derived from a goal plan.
+func TargetsWithAdjustment(p Profile, adjustment float64) types.MacroTotals {
+	return MacrosForCalories(TDEE(p)+adjustment, p.WeightKg)
+}
+
+// MacrosForCalories splits a calorie target into protein based on body
+// weight, a fixed fat share and carbs for the remainder.
+func MacrosForCalories(calories, weightKg float64) types.MacroTotals {
+	protein := weightKg * ProteinPerKg
+	fat := calories * FatCaloriesShare / KcalPerGramFat
+	carbs := (calories - protein*KcalPerGramProtein - fat*KcalPerGramFat) / KcalPerGramCarbs
+
+	return types.MacroTotals{
+		Calories: math.Round(calories),
+		ProteinG: math.Round(protein),
+		CarbsG:   math.Round(max(carbs, 0)),
+		FatG:     math.Round(fat),
+	}
+}
@@ -0,0 +1,146 @@
+package nutrition
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TargetScheduleFromRecord returns the profile's target schedule, or nil
+// when it has none.
+func TargetScheduleFromRecord(record *core.Record) (*types.TargetSchedule, error) {
+	var schedule *types.TargetSchedule
+	if err := record.UnmarshalJSONField("target_schedule", &schedule); err != nil {
+		return nil, err
+	}
+
+	if schedule == nil || schedule.Mode == "" {
+		return nil, nil
+	}
+
+	return schedule, nil
+}
+
+// IsTrainingActivity reports whether an activity of the given type makes
+// the day a training day.
+func IsTrainingActivity(schedule *types.TargetSchedule, activityType string) bool {
+	if schedule == nil || len(schedule.TrainingTypes) == 0 {
+		return activityType != "" && activityType != types.ACTIVITY_WALKING
+	}
+
+	return slices.Contains(schedule.TrainingTypes, activityType)
+}
+
+// withCalories fills in the calories of an offset that only moves macros,
+// using 4/4/9 kcal per gram.
+func withCalories(m types.MacroTotals) types.MacroTotals {
+	if m.Calories == 0 {
+		m.Calories = m.ProteinG*4 + m.CarbsG*4 + m.FatG*9
+	}
+
+	return m
+}
+
+func weekdayKey(day time.Weekday) string {
+	return strings.ToLower(day.String())
+}
+
+// DayOffset returns the balanced offset for the given weekday. Weekday
+// offsets are shifted by their mean and rest days absorb the training
+// surplus, so the offsets of a regular week add up to zero.
+//
+// A day's targets are needed before the rest of the week is known, so rest
+// days are balanced against TrainingDaysPerWeek, not the training days that
+// actually happen. The weekly total is only kept when the user trains that
+// many days, each extra training day adds the training offset plus a rest
+// day's share on top and each missed one takes it off again.
+func DayOffset(schedule *types.TargetSchedule, day time.Weekday, training bool) types.MacroTotals {
+	if schedule == nil {
+		return types.MacroTotals{}
+	}
+
+	switch schedule.Mode {
+	case types.TARGET_SCHEDULE_WEEKDAY:
+		var total types.MacroTotals
+		for _, offset := range schedule.Weekdays {
+			total = total.Add(withCalories(offset))
+		}
+
+		return withCalories(schedule.Weekdays[weekdayKey(day)]).Add(total.Scale(-1.0 / 7))
+
+	case types.TARGET_SCHEDULE_TRAINING:
+		n := schedule.TrainingDaysPerWeek
+		if n < 1 || n > 6 {
+			return types.MacroTotals{}
+		}
+
+		offset := withCalories(schedule.Training)
+		if training {
+			return offset
+		}
+
+		return offset.Scale(-float64(n) / float64(7-n))
+	}
+
+	return types.MacroTotals{}
+}
+
+// DayTargets resolves the targets for a single day from the profile's base
+// targets and schedule.
+func DayTargets(base types.MacroTotals, schedule *types.TargetSchedule, day time.Weekday, training bool) types.MacroTotals {
+	targets := base.Add(DayOffset(schedule, day, training))
+
+	return types.MacroTotals{
+		Calories: math.Max(0, math.Round(targets.Calories)),
+		ProteinG: math.Max(0, math.Round(targets.ProteinG)),
+		CarbsG:   math.Max(0, math.Round(targets.CarbsG)),
+		FatG:     math.Max(0, math.Round(targets.FatG)),
+	}
+}
+
+// ValidateTargetSchedule checks the schedule's shape and that no day ends
+// up with negative targets.
+func ValidateTargetSchedule(schedule *types.TargetSchedule, base types.MacroTotals) error {
+	if schedule == nil {
+		return nil
+	}
+
+	switch schedule.Mode {
+	case types.TARGET_SCHEDULE_WEEKDAY:
+		for key := range schedule.Weekdays {
+			valid := false
+			for day := time.Sunday; day <= time.Saturday; day++ {
+				if key == weekdayKey(day) {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return fmt.Errorf("unknown weekday %q", key)
+			}
+		}
+	case types.TARGET_SCHEDULE_TRAINING:
+		if schedule.TrainingDaysPerWeek < 1 || schedule.TrainingDaysPerWeek > 6 {
+			return errors.New("training_days_per_week must be between 1 and 6")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q, expected weekday or training", schedule.Mode)
+	}
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		for _, training := range []bool{false, true} {
+			t := base.Add(DayOffset(schedule, day, training))
+			if t.Calories < 0 || t.ProteinG < 0 || t.CarbsG < 0 || t.FatG < 0 {
+				return fmt.Errorf("targets on %s would be negative", weekdayKey(day))
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package nutrition
+
+import (
+	"math"
+	"time"
+)
+
+// TrendSmoothing is the daily smoothing factor of the weight trend. Around
+// 0.1 evens out water weight swings while still following real change
+// within a couple of weeks.
+const TrendSmoothing = 0.1
+
+// RateWindow is how far back the weekly rate of change looks.
+const RateWindow = 14 * 24 * time.Hour
+
+type WeightSample struct {
+	At       time.Time
+	WeightKg float64
+}
+
+// SmoothWeights returns an exponentially smoothed trend value for every
+// sample, which must be sorted by time. The smoothing factor is scaled by
+// the gap between samples so missed weigh-ins don't stall the trend.
+func SmoothWeights(samples []WeightSample) []float64 {
+	trend := make([]float64, len(samples))
+
+	for i, sample := range samples {
+		if i == 0 {
+			trend[i] = sample.WeightKg
+			continue
+		}
+
+		days := sample.At.Sub(samples[i-1].At).Hours() / 24
+		alpha := 1 - math.Pow(1-TrendSmoothing, max(days, 0))
+		trend[i] = trend[i-1] + alpha*(sample.WeightKg-trend[i-1])
+	}
+
+	return trend
+}
+
+// WeeklyRate returns the trend's change in kg per week, using a least
+// squares fit over the samples within RateWindow of the latest one.
+func WeeklyRate(samples []WeightSample, trend []float64) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+
+	latest := samples[len(samples)-1].At
+
+	var n, sumX, sumY, sumXY, sumXX float64
+	for i, sample := range samples {
+		if latest.Sub(sample.At) > RateWindow {
+			continue
+		}
+
+		x := sample.At.Sub(latest).Hours() / 24
+		n++
+		sumX += x
+		sumY += trend[i]
+		sumXY += x * trend[i]
+		sumXX += x * x
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if n < 2 || denominator == 0 {
+		return 0
+	}
+
+	return (n*sumXY - sumX*sumY) / denominator * 7
+}
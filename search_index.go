@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// indexMealText replaces the template's row in the keyword index with its
+// current name and descriptions.
+func indexMealText(app core.App, record *core.Record) error {
+	if err := deleteMealText(app, record.Id); err != nil {
+		return err
+	}
+
+	_, err := app.DB().NewQuery(`
+		INSERT INTO meal_templates_fts(meal_template_id, user_id, name, description, ai_description)
+		VALUES ({:id}, {:userId}, {:name}, {:description}, {:aiDescription})
+	`).Bind(dbx.Params{
+		"id":            record.Id,
+		"userId":        record.GetString("user"),
+		"name":          record.GetString("name"),
+		"description":   record.GetString("description"),
+		"aiDescription": record.GetString("ai_description"),
+	}).Execute()
+
+	if err != nil {
+		slog.Error("Failed to index meal text", "recordId", record.Id, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func deleteMealText(app core.App, recordId string) error {
+	_, err := app.DB().NewQuery("DELETE FROM meal_templates_fts WHERE meal_template_id = {:id}").Bind(dbx.Params{
+		"id": recordId,
+	}).Execute()
+
+	if err != nil {
+		slog.Error("Failed to delete meal text", "recordId", recordId, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// mealTextChanged tells whether an update touched any of the indexed fields.
+func mealTextChanged(record *core.Record) bool {
+	original := record.Original()
+	for _, field := range []string{"user", "name", "description", "ai_description"} {
+		if original.GetString(field) != record.GetString(field) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -14,8 +14,93 @@ const (
 	COL_MEAL_TEMPLATES Collection = "meal_templates"
 	COL_MEAL_HISTORY   Collection = "meal_history"
 	COL_ACTIVITY_LOGS  Collection = "activity_logs"
+	COL_USER_PROFILES  Collection = "user_profiles"
+	COL_WEIGHT_LOGS    Collection = "weight_logs"
+	COL_TDEE_PROPOSALS Collection = "tdee_proposals"
+	COL_GOAL_PLANS     Collection = "goal_plans"
+	COL_USERS          Collection = "users"
 )
 
+type MealSlot = string
+
+const (
+	MEAL_SLOT_BREAKFAST MealSlot = "breakfast"
+	MEAL_SLOT_LUNCH     MealSlot = "lunch"
+	MEAL_SLOT_DINNER    MealSlot = "dinner"
+	MEAL_SLOT_SNACK     MealSlot = "snack"
+)
+
+var MealSlots = []MealSlot{MEAL_SLOT_BREAKFAST, MEAL_SLOT_LUNCH, MEAL_SLOT_DINNER, MEAL_SLOT_SNACK}
+
+type ActivityType = string
+
+const (
+	ACTIVITY_WALKING           ActivityType = "walking"
+	ACTIVITY_RUNNING           ActivityType = "running"
+	ACTIVITY_CYCLING           ActivityType = "cycling"
+	ACTIVITY_SWIMMING          ActivityType = "swimming"
+	ACTIVITY_STRENGTH_TRAINING ActivityType = "strength_training"
+	ACTIVITY_HIKING            ActivityType = "hiking"
+	ACTIVITY_CUSTOM            ActivityType = "custom"
+)
+
+// MealSlotWindow is a local time-of-day range in "HH:MM" format. A window
+// whose end is before its start wraps past midnight.
+type MealSlotWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type MealSlotWindows map[MealSlot]MealSlotWindow
+
+var DefaultMealSlotWindows = MealSlotWindows{
+	MEAL_SLOT_BREAKFAST: {Start: "05:00", End: "10:30"},
+	MEAL_SLOT_LUNCH:     {Start: "11:00", End: "14:30"},
+	MEAL_SLOT_DINNER:    {Start: "17:30", End: "21:30"},
+}
+
+type AutoMatchMode = string
+
+const (
+	// AUTO_MATCH_AUTO copies the nutrition of a close enough earlier meal
+	// instead of analyzing the photo
+	AUTO_MATCH_AUTO AutoMatchMode = "auto"
+	// AUTO_MATCH_SUGGEST analyzes the photo and attaches the close match as
+	// a suggestion for the user to confirm or reject
+	AUTO_MATCH_SUGGEST AutoMatchMode = "suggest"
+	AUTO_MATCH_OFF     AutoMatchMode = "off"
+)
+
+// DefaultAutoMatchDistance is the image vector distance below which two
+// meals count as the same dish.
+const DefaultAutoMatchDistance = 0.1
+
+const (
+	TARGET_SCHEDULE_WEEKDAY  = "weekday"
+	TARGET_SCHEDULE_TRAINING = "training"
+)
+
+// TargetSchedule shifts the profile's daily targets between the days of the
+// week. Offsets are relative to the profile targets and get balanced so the
+// weekly total stays the same.
+type TargetSchedule struct {
+	Mode string `json:"mode"`
+
+	// Weekdays holds offsets keyed by lowercase weekday name, missing days
+	// only get the balancing offset
+	Weekdays map[string]MacroTotals `json:"weekdays,omitempty"`
+
+	// Training is the offset for days with a training activity, rest days
+	// get the opposite spread over the remaining days of the week. The
+	// weekly total only holds when TrainingDaysPerWeek matches the week.
+	Training            MacroTotals `json:"training,omitempty"`
+	TrainingDaysPerWeek int         `json:"training_days_per_week,omitempty"`
+
+	// TrainingTypes lists the activity types that make a training day,
+	// empty means anything but walking
+	TrainingTypes []string `json:"training_types,omitempty"`
+}
+
 type MealTemplate struct {
 	ID                        string    `json:"id,omitempty"`
 	ImageURL                  string    `json:"image_url,omitempty"`
@@ -31,6 +116,7 @@ type MealTemplate struct {
 	TotalFatG                 int       `json:"total_fat_g"`
 	FatUncertaintyPercent     int       `json:"fat_uncertainty_percent"`
 	AnalysisNotes             string    `json:"analysis_notes"`
+	MealType                  string    `json:"meal_type"`
 	ProcessingStatus          string    `json:"processing_status,omitempty"`
 	Created                   time.Time `json:"created"`
 	Updated                   time.Time `json:"updated"`
@@ -47,21 +133,26 @@ type MealHistory struct {
 	CarbsAdjustment   float64   `json:"carbs_adjustment"`
 	FatAdjustment     float64   `json:"fat_adjustment"`
 	Name              string    `json:"meal_name,omitempty"`
+	ConsumedAt        time.Time `json:"consumed_at"`
+	MealSlot          string    `json:"meal_slot"`
 	Created           time.Time `json:"created"`
 	Updated           time.Time `json:"updated"`
 }
 
 type UserProfiles struct {
-	ID       string    `json:"id,omitempty"`
-	User     string    `json:"user"`
-	Age      int       `json:"age"`
-	WeightKg float64   `json:"weight_kg"`
-	HeightCm float64   `json:"height_cm"`
-	Gender   string    `json:"gender"`
-	Activity string    `json:"activity"`
-	Goal     string    `json:"goal"`
-	Created  time.Time `json:"created"`
-	Updated  time.Time `json:"updated"`
+	ID              string          `json:"id,omitempty"`
+	User            string          `json:"user"`
+	Age             int             `json:"age"`
+	WeightKg        float64         `json:"weight_kg"`
+	HeightCm        float64         `json:"height_cm"`
+	Gender          string          `json:"gender"`
+	Activity        string          `json:"activity"`
+	Goal            string          `json:"goal"`
+	Timezone        string          `json:"timezone,omitempty"`
+	MealSlotWindows MealSlotWindows `json:"meal_slot_windows,omitempty"`
+	TargetSchedule  *TargetSchedule `json:"target_schedule,omitempty"`
+	Created         time.Time       `json:"created"`
+	Updated         time.Time       `json:"updated"`
 }
 
 type ActivityLog struct {
@@ -86,6 +177,228 @@ type SimilarMeal struct {
 	AiDescription string  `json:"ai_description" db:"ai_description"`
 	ImageURL      string  `json:"image_url,omitempty"`
 	Created       string  `json:"created" db:"created"`
+
+	LinkedMealTemplateID string `json:"linked_meal_template_id"`
+	IsPrimaryInGroup     bool   `json:"is_primary_in_group"`
+}
+
+type SimilarMealsPage struct {
+	Page    int           `json:"page"`
+	Limit   int           `json:"limit"`
+	HasMore bool          `json:"has_more"`
+	Items   []SimilarMeal `json:"items"`
+}
+
+const (
+	VECTOR_SET_ACTIVE   = "active"
+	VECTOR_SET_BUILDING = "building"
+)
+
+// VectorSet is a vec0 table of meal image vectors made by one embedding
+// model. Similarity is only ever searched in the active set, a building set
+// is filled by a reindex before it replaces the active one.
+type VectorSet struct {
+	Name       string `json:"name" db:"name"`
+	Model      string `json:"model" db:"model"`
+	Dimensions int    `json:"dimensions" db:"dimensions"`
+	Status     string `json:"status" db:"status"`
+}
+
+const (
+	SEARCH_SOURCE_KEYWORD = "keyword"
+	SEARCH_SOURCE_IMAGE   = "image"
+)
+
+// MealSearchHit is a meal found by keyword, by image similarity or both.
+// Distance is only set for image hits.
+type MealSearchHit struct {
+	SimilarMeal
+	Score   float64  `json:"score"`
+	Sources []string `json:"sources"`
+}
+
+type MealSearchPage struct {
+	Page    int             `json:"page"`
+	Limit   int             `json:"limit"`
+	HasMore bool            `json:"has_more"`
+	Items   []MealSearchHit `json:"items"`
+}
+
+type MacroTotals struct {
+	Calories float64 `json:"calories"`
+	ProteinG float64 `json:"protein_g"`
+	CarbsG   float64 `json:"carbs_g"`
+	FatG     float64 `json:"fat_g"`
+}
+
+func (m MacroTotals) Add(o MacroTotals) MacroTotals {
+	return MacroTotals{
+		Calories: m.Calories + o.Calories,
+		ProteinG: m.ProteinG + o.ProteinG,
+		CarbsG:   m.CarbsG + o.CarbsG,
+		FatG:     m.FatG + o.FatG,
+	}
+}
+
+func (m MacroTotals) Sub(o MacroTotals) MacroTotals {
+	return m.Add(o.Scale(-1))
+}
+
+func (m MacroTotals) Scale(factor float64) MacroTotals {
+	return MacroTotals{
+		Calories: m.Calories * factor,
+		ProteinG: m.ProteinG * factor,
+		CarbsG:   m.CarbsG * factor,
+		FatG:     m.FatG * factor,
+	}
+}
+
+type SlotSummary struct {
+	MacroTotals
+	Meals int `json:"meals"`
+}
+
+type DaySummary struct {
+	Date           string                   `json:"date"`
+	Timezone       string                   `json:"timezone"`
+	Consumed       MacroTotals              `json:"consumed"`
+	Slots          map[MealSlot]SlotSummary `json:"slots"`
+	Meals          int                      `json:"meals"`
+	CaloriesBurned float64                  `json:"calories_burned"`
+	TrainingDay    bool                     `json:"training_day"`
+	Targets        MacroTotals              `json:"targets"`
+	Remaining      MacroTotals              `json:"remaining"`
+}
+
+type ActivityTotals struct {
+	CaloriesBurned  float64 `json:"calories_burned"`
+	Steps           int     `json:"steps"`
+	DurationMinutes int     `json:"duration_minutes"`
+	Sessions        int     `json:"sessions"`
+}
+
+type MacroSplit struct {
+	ProteinPercent float64 `json:"protein_percent"`
+	CarbsPercent   float64 `json:"carbs_percent"`
+	FatPercent     float64 `json:"fat_percent"`
+}
+
+type Adherence struct {
+	CalorieDaysOnTarget int     `json:"calorie_days_on_target"`
+	ProteinDaysOnTarget int     `json:"protein_days_on_target"`
+	CaloriePercent      float64 `json:"calorie_percent"`
+	ProteinPercent      float64 `json:"protein_percent"`
+}
+
+type PeriodSummary struct {
+	Start          string         `json:"start"`
+	End            string         `json:"end"`
+	Days           int            `json:"days"`
+	LoggedDays     int            `json:"logged_days"`
+	Total          MacroTotals    `json:"total"`
+	AverageIntake  MacroTotals    `json:"average_intake"`
+	AverageTargets MacroTotals    `json:"average_targets"`
+	MacroSplit     MacroSplit     `json:"macro_split"`
+	Adherence      Adherence      `json:"adherence"`
+	Activity       ActivityTotals `json:"activity"`
+}
+
+type RangeSummary struct {
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	Timezone    string          `json:"timezone"`
+	Granularity string          `json:"granularity"`
+	Periods     []PeriodSummary `json:"periods"`
+	Overall     PeriodSummary   `json:"overall"`
+}
+
+type ExportMeal struct {
+	ID                string    `json:"id"`
+	ConsumedAt        time.Time `json:"consumed_at"`
+	MealSlot          string    `json:"meal_slot"`
+	MealTemplateID    string    `json:"meal_template_id"`
+	Name              string    `json:"name"`
+	PortionMultiplier float64   `json:"portion_multiplier"`
+	MacroTotals
+}
+
+type ExportActivity struct {
+	ID              string    `json:"id"`
+	StartedAt       time.Time `json:"started_at"`
+	ActivityType    string    `json:"activity_type"`
+	Name            string    `json:"name,omitempty"`
+	Steps           int       `json:"steps"`
+	DurationMinutes int       `json:"duration_minutes"`
+	DistanceKm      float64   `json:"distance_km"`
+	AvgHeartRate    float64   `json:"avg_heart_rate"`
+	CaloriesBurned  float64   `json:"calories_burned"`
+}
+
+type DiaryExport struct {
+	From       string           `json:"from"`
+	To         string           `json:"to"`
+	Timezone   string           `json:"timezone"`
+	Meals      []ExportMeal     `json:"meals"`
+	Activities []ExportActivity `json:"activities"`
+}
+
+// AccountDeletionReport lists what was deleted for a user, keyed by
+// collection, and what could still be found afterwards.
+type AccountDeletionReport struct {
+	UserID    string         `json:"user_id"`
+	Deleted   map[string]int `json:"deleted"`
+	Remaining map[string]int `json:"remaining"`
+	Verified  bool           `json:"verified"`
+}
+
+type WeightPoint struct {
+	ID         string    `json:"id"`
+	MeasuredAt time.Time `json:"measured_at"`
+	WeightKg   float64   `json:"weight_kg"`
+	TrendKg    float64   `json:"trend_kg"`
+}
+
+type WeightTrend struct {
+	Points            []WeightPoint `json:"points"`
+	LatestKg          float64       `json:"latest_kg"`
+	TrendKg           float64       `json:"trend_kg"`
+	WeeklyRateKg      float64       `json:"weekly_rate_kg"`
+	WeeklyRatePercent float64       `json:"weekly_rate_percent"`
+}
+
+type AdaptiveEstimate struct {
+	WindowStart      string  `json:"window_start"`
+	WindowEnd        string  `json:"window_end"`
+	WindowDays       int     `json:"window_days"`
+	LoggedDays       int     `json:"logged_days"`
+	WeightPoints     int     `json:"weight_points"`
+	AverageIntake    float64 `json:"average_intake"`
+	TrendStartKg     float64 `json:"trend_start_kg"`
+	TrendEndKg       float64 `json:"trend_end_kg"`
+	EstimatedTDEE    float64 `json:"estimated_tdee"`
+	FormulaTDEE      float64 `json:"formula_tdee"`
+	CurrentCalories  float64 `json:"current_calories"`
+	ProposedCalories float64 `json:"proposed_calories"`
+	Sufficient       bool    `json:"sufficient"`
+	Reason           string  `json:"reason,omitempty"`
+}
+
+type GoalProgress struct {
+	PlanID            string  `json:"plan_id"`
+	StartDate         string  `json:"start_date"`
+	StartWeightKg     float64 `json:"start_weight_kg"`
+	TargetDate        string  `json:"target_date"`
+	TargetWeightKg    float64 `json:"target_weight_kg"`
+	PlannedRateKg     float64 `json:"planned_rate_kg"`
+	DailyCalorieDelta float64 `json:"daily_calorie_delta"`
+	Warning           string  `json:"warning,omitempty"`
+	ProjectedKg       float64 `json:"projected_kg"`
+	TrendKg           float64 `json:"trend_kg"`
+	DifferenceKg      float64 `json:"difference_kg"`
+	ActualRateKg      float64 `json:"actual_rate_kg"`
+	OnTrack           bool    `json:"on_track"`
+	// EstimatedWeeksLeft is -1 when the current trend moves away from the target
+	EstimatedWeeksLeft float64 `json:"estimated_weeks_left"`
 }
 
 func MealTemplateFromRecord(r *core.Record) MealTemplate {
@@ -102,6 +415,7 @@ func MealTemplateFromRecord(r *core.Record) MealTemplate {
 		CarbsUncertaintyPercent:   r.GetInt("carbs_uncertainty_percent"),
 		TotalFatG:                 r.GetInt("total_fat_g"),
 		FatUncertaintyPercent:     r.GetInt("fat_uncertainty_percent"),
+		MealType:                  r.GetString("meal_type"),
 		ProcessingStatus:          r.GetString("processing_status"),
 		Created:                   r.GetDateTime("created").Time(),
 		Updated:                   r.GetDateTime("updated").Time(),
@@ -120,6 +434,8 @@ func MealHistoryFromRecord(r *core.Record) MealHistory {
 		CarbsAdjustment:   r.GetFloat("carbs_adjustment"),
 		FatAdjustment:     r.GetFloat("fat_adjustment"),
 		Name:              r.GetString("meal_name"),
+		ConsumedAt:        r.GetDateTime("consumed_at").Time(),
+		MealSlot:          r.GetString("meal_slot"),
 		Created:           r.GetDateTime("created").Time(),
 		Updated:           r.GetDateTime("updated").Time(),
 	}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/ignoxx/caloriemate/nutrition"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// applyNutritionTargets computes the profile's daily targets unless the
+// user opted into custom values.
+func applyNutritionTargets(app core.App, record *core.Record) {
+	if record.GetBool("custom_targets") {
+		return
+	}
+
+	profile := nutrition.ProfileFromRecord(record)
+	if !profile.Complete() {
+		return
+	}
+
+	adjustment := nutrition.GoalAdjustmentFor(app, record.GetString("user"), profile.Goal)
+	targets := nutrition.TargetsWithAdjustment(profile, adjustment)
+	record.Set("target_calories", targets.Calories)
+	record.Set("target_protein_g", targets.ProteinG)
+	record.Set("target_carbs_g", targets.CarbsG)
+	record.Set("target_fat_g", targets.FatG)
+
+	slog.Info("Computed nutrition targets", "recordId", record.Id, "calories", targets.Calories, "protein", targets.ProteinG)
+}
+
+// syncProfileWeight copies the user's most recent weigh-in to the profile so
+// targets and activity calories use the current weight.
+func syncProfileWeight(app core.App, userID string) error {
+	latest, err := app.FindRecordsByFilter(types.COL_WEIGHT_LOGS, "user = {:user}", "-measured_at", 1, 0, map[string]any{"user": userID})
+	if err != nil || len(latest) == 0 {
+		return err
+	}
+
+	profile, err := app.FindFirstRecordByData(types.COL_USER_PROFILES, "user", userID)
+	if err != nil {
+		// nothing to sync before onboarding created the profile
+		return nil
+	}
+
+	weight := latest[0].GetFloat("weight_kg")
+	if profile.GetFloat("weight_kg") == weight {
+		return nil
+	}
+
+	profile.Set("weight_kg", weight)
+	if err := app.Save(profile); err != nil {
+		return err
+	}
+
+	slog.Info("Synced profile weight from weight log", "userId", userID, "weightKg", weight)
+	return nil
+}
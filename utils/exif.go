@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	exifTagIFDPointer         = 0x8769
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagOffsetTimeOriginal = 0x9011
+
+	exifDateLayout = "2006:01:02 15:04:05"
+)
+
+var ErrNoExifDate = errors.New("no EXIF DateTimeOriginal found")
+
+// ExifDateTimeOriginal reads the DateTimeOriginal tag from a JPEG image.
+// EXIF timestamps carry no zone unless OffsetTimeOriginal is present, so
+// loc is used to interpret them otherwise.
+func ExifDateTimeOriginal(image io.ReadSeeker, loc *time.Location) (time.Time, error) {
+	if _, err := image.Seek(0, io.SeekStart); err != nil {
+		return time.Time{}, err
+	}
+
+	tiff, err := findExifSegment(image)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	order, ifd0, err := parseTiffHeader(tiff)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	exifOffset, ok := readIFDValue(tiff, order, ifd0, exifTagIFDPointer)
+	if !ok {
+		return time.Time{}, ErrNoExifDate
+	}
+
+	dateOffset, ok := readIFDValue(tiff, order, exifOffset, exifTagDateTimeOriginal)
+	if !ok {
+		return time.Time{}, ErrNoExifDate
+	}
+
+	raw := readASCII(tiff, dateOffset, len(exifDateLayout))
+	if raw == "" {
+		return time.Time{}, ErrNoExifDate
+	}
+
+	if offsetOffset, ok := readIFDValue(tiff, order, exifOffset, exifTagOffsetTimeOriginal); ok {
+		if zone := readASCII(tiff, offsetOffset, 6); zone != "" {
+			if t, err := time.Parse(exifDateLayout+"-07:00", raw+zone); err == nil {
+				return t, nil
+			}
+		}
+	}
+
+	if loc == nil {
+		loc = time.Local
+	}
+
+	return time.ParseInLocation(exifDateLayout, raw, loc)
+}
+
+// findExifSegment walks the JPEG markers and returns the TIFF payload of the
+// APP1 Exif segment.
+func findExifSegment(r io.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return nil, err
+	}
+	if soi[0] != 0xFF || soi[1] != 0xD8 {
+		return nil, errors.New("not a JPEG image")
+	}
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, ErrNoExifDate
+		}
+		if marker[0] != 0xFF {
+			return nil, errors.New("invalid JPEG marker")
+		}
+
+		// start of scan or end of image, no metadata beyond this point
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return nil, ErrNoExifDate
+		}
+
+		size := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 {
+			return nil, errors.New("invalid JPEG segment size")
+		}
+
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, err
+		}
+
+		if marker[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+func parseTiffHeader(tiff []byte) (binary.ByteOrder, uint32, error) {
+	if len(tiff) < 8 {
+		return nil, 0, errors.New("truncated TIFF header")
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, errors.New("invalid TIFF byte order")
+	}
+
+	return order, order.Uint32(tiff[4:8]), nil
+}
+
+// readIFDValue returns the value/offset field of the given tag in the IFD at
+// offset. For values of 4 bytes or less this is the offset of the inline value.
+func readIFDValue(tiff []byte, order binary.ByteOrder, offset uint32, tag uint16) (uint32, bool) {
+	if int(offset)+2 > len(tiff) {
+		return 0, false
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := range count {
+		entry := int(offset) + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+
+		if order.Uint16(tiff[entry:]) != tag {
+			continue
+		}
+
+		valueCount := order.Uint32(tiff[entry+4:])
+		if tag != exifTagIFDPointer && valueCount <= 4 {
+			return uint32(entry + 8), true
+		}
+
+		return order.Uint32(tiff[entry+8:]), true
+	}
+
+	return 0, false
+}
+
+func readASCII(tiff []byte, offset uint32, length int) string {
+	end := int(offset) + length
+	if end > len(tiff) {
+		return ""
+	}
+
+	return strings.TrimRight(string(tiff[offset:end]), "\x00 ")
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+)
+
+// InferMealSlot picks the slot whose window contains the local time of t.
+// When no window or more than one window matches, the model's guess of the
+// dish type decides, and snack is the final fallback.
+func InferMealSlot(t time.Time, windows types.MealSlotWindows, guess string) types.MealSlot {
+	minute := t.Hour()*60 + t.Minute()
+
+	var candidates []types.MealSlot
+	for _, slot := range types.MealSlots {
+		window, ok := windows[slot]
+		if !ok {
+			continue
+		}
+
+		start, err := parseClock(window.Start)
+		if err != nil {
+			continue
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			continue
+		}
+
+		if inWindow(minute, start, end) {
+			candidates = append(candidates, slot)
+		}
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	if slices.Contains(types.MealSlots, guess) && (len(candidates) == 0 || slices.Contains(candidates, guess)) {
+		return guess
+	}
+
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+
+	return types.MEAL_SLOT_SNACK
+}
+
+// MergeMealSlotWindows overlays user configured windows on the defaults.
+func MergeMealSlotWindows(custom types.MealSlotWindows) types.MealSlotWindows {
+	merged := make(types.MealSlotWindows, len(types.DefaultMealSlotWindows))
+	for slot, window := range types.DefaultMealSlotWindows {
+		merged[slot] = window
+	}
+	for slot, window := range custom {
+		merged[slot] = window
+	}
+
+	return merged
+}
+
+// ValidateMealSlotWindows reports unknown slots and malformed times.
+func ValidateMealSlotWindows(windows types.MealSlotWindows) error {
+	for slot, window := range windows {
+		if !slices.Contains(types.MealSlots, slot) {
+			return fmt.Errorf("unknown meal slot %q", slot)
+		}
+		if _, err := parseClock(window.Start); err != nil {
+			return fmt.Errorf("invalid start for %s: %w", slot, err)
+		}
+		if _, err := parseClock(window.End); err != nil {
+			return fmt.Errorf("invalid end for %s: %w", slot, err)
+		}
+	}
+
+	return nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func inWindow(minute, start, end int) bool {
+	if start <= end {
+		return minute >= start && minute < end
+	}
+
+	return minute >= start || minute < end
+}
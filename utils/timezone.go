@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/pocketbase/pocketbase/core"
+	pbtypes "github.com/pocketbase/pocketbase/tools/types"
+)
+
+const DateLayout = "2006-01-02"
+
+// UserLocation returns the timezone stored on the user's profile, falling
+// back to the server's local timezone when none is set.
+func UserLocation(app core.App, userID string) *time.Location {
+	profile, err := app.FindFirstRecordByData(types.COL_USER_PROFILES, "user", userID)
+	if err != nil {
+		return time.Local
+	}
+
+	name := profile.GetString("timezone")
+	if name == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+
+	return loc
+}
+
+// DayBounds returns the start of the calendar date of day and the start of
+// the next date in loc, which are not always 24h apart around DST changes.
+func DayBounds(day time.Time, loc *time.Location) (time.Time, time.Time) {
+	y, m, d := day.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// FormatDBTime formats t the way PocketBase stores datetimes, for comparing
+// against date columns in raw queries.
+func FormatDBTime(t time.Time) string {
+	dt, _ := pbtypes.ParseDateTime(t)
+	return dt.String()
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ignoxx/caloriemate/ai"
+	"github.com/ignoxx/caloriemate/api"
+	"github.com/ignoxx/caloriemate/types"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type vectorReport struct {
+	Orphaned    int
+	Missing     int
+	Regenerated int
+	Failed      int
+}
+
+type reindexReport struct {
+	Set      types.VectorSet
+	Previous types.VectorSet
+	Total    int
+	Resumed  int
+	Embedded int
+	Failed   int
+	Switched bool
+}
+
+var errVectorsUpToDate = errors.New("vectors already use the configured model")
+
+// deleteMealVector removes the template's vector from every set.
+func deleteMealVector(app core.App, recordId string) error {
+	sets, err := api.FindVectorSets(app)
+	if err != nil {
+		return err
+	}
+
+	for _, set := range sets {
+		_, err := app.DB().NewQuery("DELETE FROM {{" + set.Name + "}} WHERE meal_template_id = {:id}").Bind(dbx.Params{
+			"id": recordId,
+		}).Execute()
+
+		if err != nil {
+			slog.Error("Failed to delete meal vector", "recordId", recordId, "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refreshMealVector re-embeds the template's current image, or drops its
+// vector when the image was removed.
+func refreshMealVector(app core.App, record *core.Record, imgLlm ai.Embedder) error {
+	if len(record.GetStringSlice("image")) == 0 {
+		return deleteMealVector(app, record.Id)
+	}
+
+	embedding, err := generateMealEmbedding(app, record, imgLlm)
+	if err != nil {
+		return err
+	}
+
+	return upsertMealVector(app, record, embedding)
+}
+
+// reconcileVectors removes vectors of templates that no longer exist or no
+// longer have an image, and embeds analyzed templates that have an image
+// but no vector. A dry run only counts. Only the active set is reconciled
+// and only while the embedder runs its model.
+func reconcileVectors(app core.App, imgLlm ai.Embedder, dryRun bool) (vectorReport, error) {
+	var report vectorReport
+
+	model, err := imgLlm.Model()
+	if err != nil {
+		return report, err
+	}
+
+	set, err := api.FindVectorSetForModel(app, model)
+	if err != nil {
+		return report, err
+	}
+
+	var vectorIDs []string
+	if err := app.DB().NewQuery("SELECT meal_template_id FROM {{" + set.Name + "}}").Column(&vectorIDs); err != nil {
+		return report, err
+	}
+
+	var withImage []string
+	if err := app.DB().Select("id").From(types.COL_MEAL_TEMPLATES).Where(dbx.NewExp("image != ''")).Column(&withImage); err != nil {
+		return report, err
+	}
+
+	hasImage := make(map[string]bool, len(withImage))
+	for _, id := range withImage {
+		hasImage[id] = true
+	}
+
+	hasVector := make(map[string]bool, len(vectorIDs))
+	for _, id := range vectorIDs {
+		hasVector[id] = true
+
+		if hasImage[id] {
+			continue
+		}
+
+		report.Orphaned++
+		if dryRun {
+			continue
+		}
+
+		if err := deleteMealVector(app, id); err != nil {
+			return report, err
+		}
+	}
+
+	// pending templates get their vector once the analysis is done
+	templates, err := findEmbeddableMeals(app)
+	if err != nil {
+		return report, err
+	}
+
+	for _, record := range templates {
+		if hasVector[record.Id] {
+			continue
+		}
+
+		report.Missing++
+		if dryRun {
+			continue
+		}
+
+		if err := refreshMealVector(app, record, imgLlm); err != nil {
+			slog.Error("Failed to regenerate meal vector", "recordId", record.Id, "error", err)
+			report.Failed++
+			continue
+		}
+		report.Regenerated++
+	}
+
+	return report, nil
+}
+
+func findEmbeddableMeals(app core.App) ([]*core.Record, error) {
+	return app.FindAllRecords(types.COL_MEAL_TEMPLATES, dbx.HashExp{"processing_status": "completed"}, dbx.NewExp("image != ''"))
+}
+
+// reindexVectors re-embeds every analyzed meal image with the configured
+// embedder into a new vector set, then makes it the active one and drops
+// the old set in a single transaction. An interrupted reindex resumes where
+// it stopped, as long as the model is still the same. Meals analyzed in the
+// meantime are written to the new set by upsertMealVector. If any image
+// fails to embed the switch is left for a rerun, which only retries those.
+func reindexVectors(app core.App, imgLlm ai.Embedder, force bool, progress func(done, total int)) (reindexReport, error) {
+	var report reindexReport
+
+	model, err := imgLlm.Model()
+	if err != nil {
+		return report, err
+	}
+	if model.Dimensions <= 0 {
+		return report, fmt.Errorf("embedding model %s reports no dimensions", model.Name)
+	}
+
+	sets, err := api.FindVectorSets(app)
+	if err != nil {
+		return report, err
+	}
+
+	var building *types.VectorSet
+	for i, set := range sets {
+		switch set.Status {
+		case types.VECTOR_SET_ACTIVE:
+			report.Previous = set
+		case types.VECTOR_SET_BUILDING:
+			if set.Model == model.Name && set.Dimensions == model.Dimensions {
+				building = &sets[i]
+				continue
+			}
+
+			slog.Info("Dropping unfinished vector set of another model", "set", set.Name, "model", set.Model)
+			if err := dropVectorSet(app, set); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if building == nil {
+		if !force && report.Previous.Model == model.Name && report.Previous.Dimensions == model.Dimensions {
+			return report, errVectorsUpToDate
+		}
+
+		set, err := createVectorSet(app, model)
+		if err != nil {
+			return report, err
+		}
+		building = &set
+	}
+	report.Set = *building
+
+	var done []string
+	if err := app.DB().NewQuery("SELECT meal_template_id FROM {{" + building.Name + "}}").Column(&done); err != nil {
+		return report, err
+	}
+
+	embedded := make(map[string]bool, len(done))
+	for _, id := range done {
+		embedded[id] = true
+	}
+
+	templates, err := findEmbeddableMeals(app)
+	if err != nil {
+		return report, err
+	}
+	report.Total = len(templates)
+
+	for i, record := range templates {
+		if embedded[record.Id] {
+			report.Resumed++
+		} else if err := refreshMealVector(app, record, imgLlm); err != nil {
+			slog.Error("Failed to reindex meal vector", "recordId", record.Id, "error", err)
+			report.Failed++
+		} else {
+			report.Embedded++
+		}
+
+		progress(i+1, len(templates))
+	}
+
+	if report.Failed > 0 {
+		return report, nil
+	}
+
+	if err := switchVectorSet(app, report.Previous, report.Set); err != nil {
+		return report, err
+	}
+	report.Switched = true
+
+	return report, nil
+}
+
+func createVectorSet(app core.App, model ai.EmbeddingModel) (types.VectorSet, error) {
+	set := types.VectorSet{
+		Name:       fmt.Sprintf("meal_image_vectors_%d", time.Now().Unix()),
+		Model:      model.Name,
+		Dimensions: model.Dimensions,
+		Status:     types.VECTOR_SET_BUILDING,
+	}
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		_, err := txApp.DB().NewQuery(fmt.Sprintf(`
+			CREATE VIRTUAL TABLE {{%s}} USING vec0(
+				user_id TEXT PARTITION KEY,
+				meal_template_id TEXT,
+				embedding float[%d]
+			)`, set.Name, set.Dimensions)).Execute()
+		if err != nil {
+			return err
+		}
+
+		_, err = txApp.DB().NewQuery("INSERT INTO meal_vector_sets(name, model, dimensions, status) VALUES ({:name}, {:model}, {:dimensions}, {:status})").Bind(dbx.Params{
+			"name":       set.Name,
+			"model":      set.Model,
+			"dimensions": set.Dimensions,
+			"status":     set.Status,
+		}).Execute()
+		return err
+	})
+
+	return set, err
+}
+
+func dropVectorSet(app core.App, set types.VectorSet) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		if _, err := txApp.DB().NewQuery("DROP TABLE IF EXISTS {{" + set.Name + "}}").Execute(); err != nil {
+			return err
+		}
+
+		_, err := txApp.DB().NewQuery("DELETE FROM meal_vector_sets WHERE name = {:name}").Bind(dbx.Params{
+			"name": set.Name,
+		}).Execute()
+		return err
+	})
+}
+
+// switchVectorSet activates the new set and drops the previous one, readers
+// see either the old or the new set, never neither.
+func switchVectorSet(app core.App, previous, next types.VectorSet) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		if previous.Name != "" {
+			if err := dropVectorSet(txApp, previous); err != nil {
+				return err
+			}
+		}
+
+		_, err := txApp.DB().NewQuery("UPDATE meal_vector_sets SET status = {:status} WHERE name = {:name}").Bind(dbx.Params{
+			"status": types.VECTOR_SET_ACTIVE,
+			"name":   next.Name,
+		}).Execute()
+		return err
+	})
+}
+
+// adoptVectorSet makes the configured embedder's model the active one when
+// the active set is still empty, like on a fresh install without the CLIP
+// service. Existing vectors are never thrown away, those need a reindex.
+func adoptVectorSet(app core.App, imgLlm ai.Embedder) error {
+	model, err := imgLlm.Model()
+	if err != nil {
+		return err
+	}
+
+	active, err := api.FindActiveVectorSet(app)
+	if err != nil {
+		return err
+	}
+	if active.Model == model.Name && active.Dimensions == model.Dimensions {
+		return nil
+	}
+
+	var count int
+	if err := app.DB().NewQuery("SELECT COUNT(*) FROM {{" + active.Name + "}}").Row(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		slog.Warn("Meal vectors come from another model, run vectors reindex", "vectors", active.Model, "embedder", model.Name)
+		return nil
+	}
+
+	sets, err := api.FindVectorSets(app)
+	if err != nil {
+		return err
+	}
+
+	var next *types.VectorSet
+	for i, set := range sets {
+		if set.Status == types.VECTOR_SET_BUILDING && set.Model == model.Name && set.Dimensions == model.Dimensions {
+			next = &sets[i]
+		}
+	}
+
+	if next == nil {
+		set, err := createVectorSet(app, model)
+		if err != nil {
+			return err
+		}
+		next = &set
+	}
+
+	slog.Info("Switching empty vector set to the configured embedder", "from", active.Model, "to", model.Name)
+	return switchVectorSet(app, active, *next)
+}
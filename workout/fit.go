@@ -0,0 +1,326 @@
+package workout
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+)
+
+// FIT global message numbers and field numbers from the FIT SDK profile,
+// only the ones needed for a workout summary.
+const (
+	fitMesgSession = 18
+	fitMesgRecord  = 20
+
+	fitFieldTimestamp = 253
+
+	fitSessionStartTime       = 2
+	fitSessionSport           = 5
+	fitSessionSubSport        = 6
+	fitSessionTotalTimerTime  = 8
+	fitSessionTotalDistance   = 9
+	fitSessionAvgHeartRate    = 16
+	fitSessionMaxHeartRate    = 17
+	fitSessionTotalAscent     = 22
+	fitRecordPositionLat      = 0
+	fitRecordPositionLong     = 1
+	fitRecordAltitude         = 2
+	fitRecordHeartRate        = 3
+	fitRecordDistance         = 5
+	fitRecordEnhancedAltitude = 78
+)
+
+// fitInvalidSint32 marks an invalid value of a signed 32 bit field, which
+// the unsigned all-ones check doesn't catch. Positions use it.
+const fitInvalidSint32 = 0x7FFFFFFF
+
+// fitEpoch is the FIT timestamp origin, 1989-12-31 00:00:00 UTC.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+var errTruncatedFIT = errors.New("truncated FIT file")
+
+type fitField struct {
+	num  byte
+	size int
+}
+
+type fitDefinition struct {
+	order     binary.ByteOrder
+	global    uint16
+	fields    []fitField
+	devLength int
+}
+
+// fitMessage maps field numbers to their raw unsigned value, invalid values
+// are left out.
+type fitMessage map[byte]uint64
+
+// ParseFIT decodes a FIT activity file. Session totals are preferred, the
+// record messages fill in whatever the session does not have.
+func ParseFIT(data []byte) (Workout, error) {
+	if len(data) < 12 || string(data[8:12]) != ".FIT" {
+		return Workout{}, errors.New("not a FIT file")
+	}
+
+	headerSize := int(data[0])
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	if headerSize < 12 || headerSize+dataSize > len(data) {
+		return Workout{}, errTruncatedFIT
+	}
+
+	var (
+		definitions   = map[byte]*fitDefinition{}
+		points        []point
+		session       fitMessage
+		lastTimestamp uint32
+	)
+
+	buf := data[headerSize : headerSize+dataSize]
+	for pos := 0; pos < len(buf); {
+		header := buf[pos]
+		pos++
+
+		// compressed timestamp header, a data message whose timestamp is
+		// an offset to the last full one
+		if header&0x80 != 0 {
+			local := (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+
+			timestamp := lastTimestamp&^0x1F | offset
+			if offset < lastTimestamp&0x1F {
+				timestamp += 0x20
+			}
+			lastTimestamp = timestamp
+
+			msg, n, err := readFITData(buf[pos:], definitions[local])
+			if err != nil {
+				return Workout{}, err
+			}
+			pos += n
+
+			msg[fitFieldTimestamp] = uint64(timestamp)
+			if definitions[local].global == fitMesgRecord {
+				points = append(points, fitPoint(msg))
+			}
+			continue
+		}
+
+		local := header & 0x0F
+
+		if header&0x40 != 0 {
+			def, n, err := readFITDefinition(buf[pos:], header&0x20 != 0)
+			if err != nil {
+				return Workout{}, err
+			}
+			pos += n
+			definitions[local] = def
+			continue
+		}
+
+		msg, n, err := readFITData(buf[pos:], definitions[local])
+		if err != nil {
+			return Workout{}, err
+		}
+		pos += n
+
+		if ts, ok := msg[fitFieldTimestamp]; ok {
+			lastTimestamp = uint32(ts)
+		}
+
+		switch definitions[local].global {
+		case fitMesgRecord:
+			points = append(points, fitPoint(msg))
+		case fitMesgSession:
+			// multisport files have several sessions, the first one wins
+			if session == nil {
+				session = msg
+			}
+		}
+	}
+
+	if len(points) == 0 && session == nil {
+		return Workout{}, errors.New("FIT file has no activity data")
+	}
+
+	w := summarize(points)
+	if session != nil {
+		applyFITSession(&w, session)
+	}
+
+	return w, nil
+}
+
+func readFITDefinition(buf []byte, hasDevFields bool) (*fitDefinition, int, error) {
+	if len(buf) < 5 {
+		return nil, 0, errTruncatedFIT
+	}
+
+	def := &fitDefinition{order: binary.LittleEndian}
+	if buf[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(buf[2:4])
+
+	count := int(buf[4])
+	pos := 5
+	if len(buf) < pos+count*3 {
+		return nil, 0, errTruncatedFIT
+	}
+
+	for range count {
+		def.fields = append(def.fields, fitField{num: buf[pos], size: int(buf[pos+1])})
+		pos += 3
+	}
+
+	if hasDevFields {
+		if len(buf) < pos+1 {
+			return nil, 0, errTruncatedFIT
+		}
+		devCount := int(buf[pos])
+		pos++
+		if len(buf) < pos+devCount*3 {
+			return nil, 0, errTruncatedFIT
+		}
+
+		for range devCount {
+			def.devLength += int(buf[pos+1])
+			pos += 3
+		}
+	}
+
+	return def, pos, nil
+}
+
+// readFITData reads a data message. Only unsigned integer fields of up to 8
+// bytes are decoded, which covers everything the summary needs.
+func readFITData(buf []byte, def *fitDefinition) (fitMessage, int, error) {
+	if def == nil {
+		return nil, 0, errors.New("FIT data message without definition")
+	}
+
+	msg := fitMessage{}
+	pos := 0
+	for _, field := range def.fields {
+		if len(buf) < pos+field.size {
+			return nil, 0, errTruncatedFIT
+		}
+
+		raw := buf[pos : pos+field.size]
+		pos += field.size
+
+		var value uint64
+		switch field.size {
+		case 1:
+			value = uint64(raw[0])
+		case 2:
+			value = uint64(def.order.Uint16(raw))
+		case 4:
+			value = uint64(def.order.Uint32(raw))
+		case 8:
+			value = def.order.Uint64(raw)
+		default:
+			continue
+		}
+
+		// all bits set marks an invalid value for unsigned base types
+		if value == math.MaxUint64>>(64-8*field.size) {
+			continue
+		}
+
+		msg[field.num] = value
+	}
+
+	if len(buf) < pos+def.devLength {
+		return nil, 0, errTruncatedFIT
+	}
+
+	return msg, pos + def.devLength, nil
+}
+
+func fitTime(value uint64) time.Time {
+	return fitEpoch.Add(time.Duration(value) * time.Second)
+}
+
+// semicircles converts FIT positions to degrees.
+func semicircles(value uint64) float64 {
+	return float64(int32(uint32(value))) * (180.0 / (1 << 31))
+}
+
+func fitPoint(msg fitMessage) point {
+	var p point
+
+	if ts, ok := msg[fitFieldTimestamp]; ok {
+		p.Time = fitTime(ts)
+	}
+
+	lat, hasLat := msg[fitRecordPositionLat]
+	lon, hasLon := msg[fitRecordPositionLong]
+	if hasLat && hasLon && lat != fitInvalidSint32 && lon != fitInvalidSint32 {
+		p.Lat, p.Lon, p.HasPos = semicircles(lat), semicircles(lon), true
+	}
+
+	// altitude is stored with scale 5 and offset 500
+	if alt, ok := msg[fitRecordEnhancedAltitude]; ok {
+		p.EleM, p.HasEle = float64(alt)/5-500, true
+	} else if alt, ok := msg[fitRecordAltitude]; ok {
+		p.EleM, p.HasEle = float64(alt)/5-500, true
+	}
+
+	if dist, ok := msg[fitRecordDistance]; ok {
+		p.DistanceM, p.HasDist = float64(dist)/100, true
+	}
+
+	if hr, ok := msg[fitRecordHeartRate]; ok {
+		p.HeartRate = float64(hr)
+	}
+
+	return p
+}
+
+func applyFITSession(w *Workout, session fitMessage) {
+	if v, ok := session[fitSessionStartTime]; ok {
+		w.StartedAt = fitTime(v)
+	}
+	if v, ok := session[fitSessionTotalTimerTime]; ok {
+		w.Duration = time.Duration(v) * time.Millisecond
+	}
+	if v, ok := session[fitSessionTotalDistance]; ok {
+		w.DistanceM = float64(v) / 100
+	}
+	if v, ok := session[fitSessionTotalAscent]; ok {
+		w.ElevationGainM = float64(v)
+	}
+	if v, ok := session[fitSessionAvgHeartRate]; ok {
+		w.AvgHeartRate = float64(v)
+	}
+	if v, ok := session[fitSessionMaxHeartRate]; ok {
+		w.MaxHeartRate = float64(v)
+	}
+
+	w.Sport = fitSport(session[fitSessionSport], session[fitSessionSubSport])
+}
+
+// fitSport maps the FIT sport and sub_sport enums.
+func fitSport(sport, subSport uint64) types.ActivityType {
+	switch sport {
+	case 1:
+		return types.ACTIVITY_RUNNING
+	case 2:
+		return types.ACTIVITY_CYCLING
+	case 5:
+		return types.ACTIVITY_SWIMMING
+	case 10:
+		if subSport == 20 {
+			return types.ACTIVITY_STRENGTH_TRAINING
+		}
+	case 11:
+		return types.ACTIVITY_WALKING
+	case 17:
+		return types.ACTIVITY_HIKING
+	}
+
+	return ""
+}
@@ -0,0 +1,69 @@
+package workout
+
+import (
+	"encoding/xml"
+	"errors"
+)
+
+type gpxFile struct {
+	Tracks []struct {
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []struct {
+				Lat  float64  `xml:"lat,attr"`
+				Lon  float64  `xml:"lon,attr"`
+				Ele  *float64 `xml:"ele"`
+				Time string   `xml:"time"`
+
+				// Garmin's TrackPointExtension, the most common way to
+				// store heart rate in GPX
+				HeartRate float64 `xml:"extensions>TrackPointExtension>hr"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// ParseGPX parses a GPX 1.1 track. Distance is computed from the track
+// points since GPX has no distance field.
+func ParseGPX(data []byte) (Workout, error) {
+	var file gpxFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return Workout{}, err
+	}
+
+	var (
+		points []point
+		sport  string
+	)
+	for _, track := range file.Tracks {
+		if sport == "" {
+			sport = track.Type
+		}
+
+		for _, segment := range track.Segments {
+			for _, trkpt := range segment.Points {
+				p := point{
+					Lat:       trkpt.Lat,
+					Lon:       trkpt.Lon,
+					HasPos:    true,
+					HeartRate: trkpt.HeartRate,
+					Time:      parseXMLTime(trkpt.Time),
+				}
+				if trkpt.Ele != nil {
+					p.EleM, p.HasEle = *trkpt.Ele, true
+				}
+
+				points = append(points, p)
+			}
+		}
+	}
+
+	if len(points) == 0 {
+		return Workout{}, errors.New("GPX file has no track points")
+	}
+
+	w := summarize(points)
+	w.Sport = sportFromName(sport)
+
+	return w, nil
+}
@@ -0,0 +1,101 @@
+package workout
+
+import (
+	"encoding/xml"
+	"errors"
+	"math"
+	"time"
+)
+
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		Laps  []struct {
+			TotalTimeSeconds float64 `xml:"TotalTimeSeconds"`
+			DistanceMeters   float64 `xml:"DistanceMeters"`
+			MaxHeartRate     float64 `xml:"MaximumHeartRateBpm>Value"`
+			Trackpoints      []struct {
+				Time      string   `xml:"Time"`
+				Lat       *float64 `xml:"Position>LatitudeDegrees"`
+				Lon       *float64 `xml:"Position>LongitudeDegrees"`
+				Altitude  *float64 `xml:"AltitudeMeters"`
+				Distance  *float64 `xml:"DistanceMeters"`
+				HeartRate float64  `xml:"HeartRateBpm>Value"`
+			} `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+// ParseTCX parses a Garmin Training Center file. Lap totals are used for
+// the moving time and distance when present, since the track only covers
+// the time the device was recording.
+func ParseTCX(data []byte) (Workout, error) {
+	var file tcxFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return Workout{}, err
+	}
+
+	if len(file.Activities) == 0 {
+		return Workout{}, errors.New("TCX file has no activities")
+	}
+
+	activity := file.Activities[0]
+
+	var (
+		points      []point
+		lapSeconds  float64
+		lapDistance float64
+		lapMaxHR    float64
+	)
+	for _, lap := range activity.Laps {
+		lapSeconds += lap.TotalTimeSeconds
+		lapDistance += lap.DistanceMeters
+		lapMaxHR = math.Max(lapMaxHR, lap.MaxHeartRate)
+
+		for _, tp := range lap.Trackpoints {
+			p := point{
+				Time:      parseXMLTime(tp.Time),
+				HeartRate: tp.HeartRate,
+			}
+			if tp.Lat != nil && tp.Lon != nil {
+				p.Lat, p.Lon, p.HasPos = *tp.Lat, *tp.Lon, true
+			}
+			if tp.Altitude != nil {
+				p.EleM, p.HasEle = *tp.Altitude, true
+			}
+			if tp.Distance != nil {
+				p.DistanceM, p.HasDist = *tp.Distance, true
+			}
+
+			points = append(points, p)
+		}
+	}
+
+	w := summarize(points)
+	w.Sport = sportFromName(activity.Sport)
+
+	if lapSeconds > 0 {
+		w.Duration = time.Duration(lapSeconds * float64(time.Second))
+	}
+	if lapDistance > 0 {
+		w.DistanceM = lapDistance
+	}
+	if lapMaxHR > w.MaxHeartRate {
+		w.MaxHeartRate = lapMaxHR
+	}
+
+	if w.Duration <= 0 {
+		return Workout{}, errors.New("TCX file has no duration")
+	}
+
+	return w, nil
+}
+
+func parseXMLTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
@@ -0,0 +1,177 @@
+// Package workout parses GPX, TCX and FIT files exported by watches and
+// fitness apps into a single workout summary.
+package workout
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ignoxx/caloriemate/types"
+)
+
+var ErrUnknownFormat = errors.New("unknown workout file format, expected GPX, TCX or FIT")
+
+// minClimbMeters filters GPS altitude noise out of the elevation gain.
+const minClimbMeters = 3
+
+// Workout is the summary of a recorded activity. Sport is empty when the
+// file does not say what kind of activity it was.
+type Workout struct {
+	Sport          types.ActivityType
+	StartedAt      time.Time
+	Duration       time.Duration
+	DistanceM      float64
+	ElevationGainM float64
+	AvgHeartRate   float64
+	MaxHeartRate   float64
+}
+
+// point is a single track sample, fields not present in the file are left
+// at their zero value with the matching has* flag unset.
+type point struct {
+	Time      time.Time
+	Lat, Lon  float64
+	HasPos    bool
+	EleM      float64
+	HasEle    bool
+	DistanceM float64
+	HasDist   bool
+	HeartRate float64
+}
+
+// Parse detects the format from the file name and content.
+func Parse(name string, data []byte) (Workout, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".fit":
+		return ParseFIT(data)
+	case ".gpx":
+		return ParseGPX(data)
+	case ".tcx":
+		return ParseTCX(data)
+	}
+
+	switch {
+	case len(data) >= 12 && string(data[8:12]) == ".FIT":
+		return ParseFIT(data)
+	case bytes.Contains(data[:min(len(data), 1024)], []byte("<gpx")):
+		return ParseGPX(data)
+	case bytes.Contains(data[:min(len(data), 1024)], []byte("<TrainingCenterDatabase")):
+		return ParseTCX(data)
+	}
+
+	return Workout{}, ErrUnknownFormat
+}
+
+// summarize computes the workout totals from the track samples. Distances
+// recorded by the device win over the ones computed from positions.
+func summarize(points []point) Workout {
+	var w Workout
+	if len(points) == 0 {
+		return w
+	}
+
+	var (
+		first, last time.Time
+		hrSum       float64
+		hrCount     int
+		climbRef    float64
+		hasClimbRef bool
+		prevPos     *point
+		gpsDistance float64
+		devDistance float64
+	)
+
+	for i := range points {
+		p := &points[i]
+
+		if !p.Time.IsZero() {
+			if first.IsZero() {
+				first = p.Time
+			}
+			last = p.Time
+		}
+
+		if p.HasPos {
+			if prevPos != nil {
+				gpsDistance += haversine(prevPos.Lat, prevPos.Lon, p.Lat, p.Lon)
+			}
+			prevPos = p
+		}
+
+		if p.HasDist && p.DistanceM > devDistance {
+			devDistance = p.DistanceM
+		}
+
+		if p.HasEle {
+			switch {
+			case !hasClimbRef:
+				climbRef, hasClimbRef = p.EleM, true
+			case p.EleM-climbRef >= minClimbMeters:
+				w.ElevationGainM += p.EleM - climbRef
+				climbRef = p.EleM
+			case p.EleM < climbRef:
+				climbRef = p.EleM
+			}
+		}
+
+		if p.HeartRate > 0 {
+			hrSum += p.HeartRate
+			hrCount++
+			w.MaxHeartRate = math.Max(w.MaxHeartRate, p.HeartRate)
+		}
+	}
+
+	w.StartedAt = first
+	w.Duration = last.Sub(first)
+
+	w.DistanceM = gpsDistance
+	if devDistance > 0 {
+		w.DistanceM = devDistance
+	}
+
+	if hrCount > 0 {
+		w.AvgHeartRate = math.Round(hrSum / float64(hrCount))
+	}
+
+	return w
+}
+
+// haversine returns the great-circle distance in meters.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusM = 6371000
+
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusM * math.Asin(math.Sqrt(a))
+}
+
+// sportFromName maps the free-form sport names used by GPX and TCX files.
+func sportFromName(name string) types.ActivityType {
+	name = strings.ToLower(name)
+
+	switch {
+	case strings.Contains(name, "run"):
+		return types.ACTIVITY_RUNNING
+	case strings.Contains(name, "bik"), strings.Contains(name, "cycl"), strings.Contains(name, "ride"):
+		return types.ACTIVITY_CYCLING
+	case strings.Contains(name, "swim"):
+		return types.ACTIVITY_SWIMMING
+	case strings.Contains(name, "hik"):
+		return types.ACTIVITY_HIKING
+	case strings.Contains(name, "walk"):
+		return types.ACTIVITY_WALKING
+	case strings.Contains(name, "strength"), strings.Contains(name, "weight"):
+		return types.ACTIVITY_STRENGTH_TRAINING
+	}
+
+	return ""
+}